@@ -0,0 +1,145 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// adminIDs are the bot operators listed in AdminUserIDs. They are admins in
+// every group and room.
+var adminIDs = map[string]bool{}
+
+// admins holds the users made admin of each group or room with /admin add.
+var admins = &adminList{Users: map[string]map[string]bool{}}
+
+type adminList struct {
+	mu    sync.Mutex
+	Users map[string]map[string]bool `json:"users"`
+}
+
+func init() {
+	registerCommand("admin", adminCommand)
+	registerHelp("admin", commandHelp{
+		Summary:    "List the admins, or make members admin",
+		SummaryFa:  "فهرست مدیران، یا مدیر کردن اعضا",
+		Usage:      []string{"/admin"},
+		AdminUsage: []string{"/admin add @member", "/admin remove @member"},
+		Where:      inShared,
+	})
+}
+
+func (a *adminList) load() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := db.load("admins", a); err != nil {
+		log.Print(err)
+	}
+}
+
+func (a *adminList) set(id, userID string, admin bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.Users[id] == nil {
+		a.Users[id] = map[string]bool{}
+	}
+	if admin {
+		a.Users[id][userID] = true
+	} else {
+		delete(a.Users[id], userID)
+	}
+	if err := db.save("admins", a); err != nil {
+		log.Print(err)
+	}
+}
+
+func (a *adminList) list(id string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var userIDs []string
+	for userID := range a.Users[id] {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
+// isAdmin reports whether the user of src may manage its group or room.
+func isAdmin(src *linebot.EventSource) bool {
+	if adminIDs[src.UserID] {
+		return true
+	}
+	admins.mu.Lock()
+	defer admins.mu.Unlock()
+	return admins.Users[sourceID(src)][src.UserID]
+}
+
+func adminCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	id := sourceID(event.Source)
+	if len(args) == 0 || strings.EqualFold(args[0], "list") {
+		var names []string
+		for _, userID := range admins.list(id) {
+			names = append(names, displayName(event.Source, userID))
+		}
+		if len(names) == 0 {
+			return textReplyf("No admins here yet.")
+		}
+		return textReplyf("Admins: %s", strings.Join(names, ", "))
+	}
+	add := strings.EqualFold(args[0], "add")
+	if !add && !strings.EqualFold(args[0], "remove") {
+		return textReplyf("Usage: /admin [list], /admin add @member, /admin remove @member")
+	}
+	if !isAdmin(event.Source) {
+		return textReplyf("Only admins can change admins.")
+	}
+	userIDs := mentions(event)
+	if len(userIDs) == 0 {
+		return textReplyf("Mention the members to %s.", strings.ToLower(args[0]))
+	}
+	var names []string
+	for _, userID := range userIDs {
+		admins.set(id, userID, add)
+		names = append(names, displayName(event.Source, userID))
+	}
+	if add {
+		return textReplyf("%s can now manage this chat.", strings.Join(names, ", "))
+	}
+	return textReplyf("%s no longer manage this chat.", strings.Join(names, ", "))
+}
+
+// adminToken guards the admin HTTP pages, from AdminToken. The pages are
+// disabled while it is empty.
+var adminToken string
+
+// requireAdmin lets a request through to h if it carries the admin token as
+// a bearer token or as the password of basic authentication.
+func requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, password, ok := r.BasicAuth(); ok {
+			token = password
+		}
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="linebot-group"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
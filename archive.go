@@ -0,0 +1,460 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	archiveQuotaMB   = 200
+	archiveKeepDays  = 90
+	albumItems       = 10
+	albumLinkTTL     = 24 * time.Hour // how long /album links work
+	archiveSweepTime = time.Hour
+)
+
+func init() {
+	registerCommand("archive", archiveCommand)
+	registerCommand("album", albumCommand)
+	registerHelp("archive", commandHelp{
+		Summary:    "Show or change how media is archived",
+		SummaryFa:  "نمایش یا تغییر تنظیمات آرشیو رسانه",
+		Usage:      []string{"/archive"},
+		AdminUsage: []string{"/archive on", "/archive off", "/archive quota 100", "/archive keep 30"},
+		Where:      inShared,
+	})
+	registerHelp("album", commandHelp{
+		Summary:   "Show the latest archived media",
+		SummaryFa: "نمایش آخرین رسانه‌های آرشیو شده",
+		Usage:     []string{"/album"},
+		Where:     inShared,
+	})
+	registerMessageHook(mediaHook)
+}
+
+// archiveItem is a saved image, video, audio or file message.
+type archiveItem struct {
+	MessageID   string    `json:"messageId"`
+	Hash        string    `json:"hash"`
+	Type        string    `json:"type"`
+	FileName    string    `json:"fileName,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	Size        int64     `json:"size"`
+	UserID      string    `json:"userId"`
+	Time        time.Time `json:"time"`
+}
+
+// chatArchive is the archive of one group or room. Archiving is off until an
+// admin turns it on.
+type chatArchive struct {
+	Enabled  bool          `json:"enabled"`
+	QuotaMB  int           `json:"quotaMB"`
+	KeepDays int           `json:"keepDays"`
+	Items    []archiveItem `json:"items"`
+}
+
+func (c *chatArchive) used() int64 {
+	var n int64
+	for _, item := range c.Items {
+		n += item.Size
+	}
+	return n
+}
+
+// archives holds the media archive of every group and room.
+var archives = &archiveBook{Chats: map[string]*chatArchive{}}
+
+type archiveBook struct {
+	mu    sync.Mutex
+	Chats map[string]*chatArchive `json:"chats"`
+}
+
+func (a *archiveBook) load() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := db.load("archive", a); err != nil {
+		log.Print(err)
+	}
+}
+
+// update changes the archive of chat id with fn and saves it.
+func (a *archiveBook) update(id string, fn func(c *chatArchive)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.Chats[id]
+	if c == nil {
+		c = &chatArchive{QuotaMB: archiveQuotaMB, KeepDays: archiveKeepDays}
+		a.Chats[id] = c
+	}
+	fn(c)
+	if err := db.save("archive", a); err != nil {
+		log.Print(err)
+	}
+}
+
+// get returns a copy of the archive of chat id.
+func (a *archiveBook) get(id string) chatArchive {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c := a.Chats[id]; c != nil {
+		copied := *c
+		copied.Items = append([]archiveItem(nil), c.Items...)
+		return copied
+	}
+	return chatArchive{QuotaMB: archiveQuotaMB, KeepDays: archiveKeepDays}
+}
+
+func (a *archiveBook) ids() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var ids []string
+	for id := range a.Chats {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// forgetChat deletes the archived items of chat id, keeping its settings.
+func (a *archiveBook) forgetChat(id string) {
+	a.mu.Lock()
+	c := a.Chats[id]
+	if c == nil || len(c.Items) == 0 {
+		a.mu.Unlock()
+		return
+	}
+	items := c.Items
+	c.Items = nil
+	if err := db.save("archive", a); err != nil {
+		log.Print(err)
+	}
+	a.mu.Unlock()
+	for _, item := range items {
+		removeUnusedContent(item.Hash)
+	}
+}
+
+// references reports whether any archive item uses the content hash.
+func (a *archiveBook) references(hash string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, c := range a.Chats {
+		for _, item := range c.Items {
+			if item.Hash == hash {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expire drops items older than each chat keeps them and deletes content
+// that nothing refers to any more.
+func (a *archiveBook) expire() {
+	var dropped []string
+	a.mu.Lock()
+	for _, c := range a.Chats {
+		cutoff := time.Now().AddDate(0, 0, -c.KeepDays)
+		items := c.Items[:0]
+		for _, item := range c.Items {
+			if c.KeepDays > 0 && item.Time.Before(cutoff) {
+				dropped = append(dropped, item.Hash)
+				continue
+			}
+			items = append(items, item)
+		}
+		c.Items = items
+	}
+	if len(dropped) > 0 {
+		if err := db.save("archive", a); err != nil {
+			log.Print(err)
+		}
+	}
+	a.mu.Unlock()
+	for _, hash := range dropped {
+		removeUnusedContent(hash)
+	}
+}
+
+// removeUnusedContent deletes stored content once nothing refers to it.
+func removeUnusedContent(hash string) {
+	if archives.references(hash) || notebook.references(hash) {
+		return
+	}
+	if err := os.Remove(contentPath(hash)); err != nil && !os.IsNotExist(err) {
+		log.Print(err)
+	}
+}
+
+// sweepArchives applies the retention of every chat periodically.
+func sweepArchives() {
+	for {
+		archives.expire()
+		scheduled("Archive retention", time.Now(), time.Now().Add(archiveSweepTime))
+		time.Sleep(archiveSweepTime)
+	}
+}
+
+// mediaHook downloads each media message once for the archive and the
+// repost detection of its chat. Videos and files can be large and images
+// are slow to hash, so neither happens while LINE waits for the webhook to
+// answer.
+func mediaHook(api botAPI, event *linebot.Event) {
+	item := archiveItem{UserID: event.Source.UserID, Time: event.Timestamp}
+	switch m := event.Message.(type) {
+	case *linebot.ImageMessage:
+		item.MessageID, item.Type = m.ID, "image"
+	case *linebot.VideoMessage:
+		item.MessageID, item.Type = m.ID, "video"
+	case *linebot.AudioMessage:
+		item.MessageID, item.Type = m.ID, "audio"
+	case *linebot.FileMessage:
+		item.MessageID, item.Type, item.FileName = m.ID, "file", m.FileName
+	default:
+		return
+	}
+	id := sourceID(event.Source)
+	quota, archiving := archiveQuota(id)
+	spotting := item.Type == "image" && spotsReposts(event.Source)
+	if !archiving && !spotting {
+		return
+	}
+	src := *event.Source
+	go func() {
+		if !archiving {
+			res, err := api.GetMessageContent(item.MessageID)
+			if err != nil {
+				log.Print(err)
+				return
+			}
+			defer res.Content.Close()
+			spotRepost(&src, res.Content, item.Time)
+			return
+		}
+		hash, contentType, size, err := fetchContent(api, item.MessageID)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		if spotting {
+			if f, err := os.Open(contentPath(hash)); err != nil {
+				log.Print(err)
+			} else {
+				spotRepost(&src, f, item.Time)
+				f.Close()
+			}
+		}
+		item.Hash, item.ContentType, item.Size = hash, contentType, size
+		if !archiveContent(id, item, quota) {
+			removeUnusedContent(hash)
+		}
+	}()
+}
+
+// archiveQuota tells whether chat id archives media, and its quota in bytes,
+// 0 for none.
+func archiveQuota(id string) (int64, bool) {
+	c := archives.get(id)
+	if !c.Enabled {
+		return 0, false
+	}
+	quota := int64(c.QuotaMB) << 20
+	if c.QuotaMB > 0 && c.used() >= quota {
+		log.Printf("Archive of %s is over its %d MB quota", id, c.QuotaMB)
+		return 0, false
+	}
+	return quota, true
+}
+
+// archiveContent adds the downloaded item to the archive of chat id unless
+// that would exceed quota bytes, and reports whether it did.
+func archiveContent(id string, item archiveItem, quota int64) bool {
+	stored := false
+	archives.update(id, func(c *chatArchive) {
+		if c.QuotaMB > 0 && c.used()+item.Size > quota {
+			log.Printf("Archive of %s is over its %d MB quota", id, c.QuotaMB)
+			return
+		}
+		c.Items = append(c.Items, item)
+		stored = true
+	})
+	return stored
+}
+
+func archiveCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	id := sourceID(event.Source)
+	if len(args) == 0 {
+		c := archives.get(id)
+		state := "off"
+		if c.Enabled {
+			state = "on"
+		}
+		return textReplyf("🗄 Archiving is %s.\n%d items, %.1f of %d MB used, kept for %d days.", state, len(c.Items), float64(c.used())/(1<<20), c.QuotaMB, c.KeepDays)
+	}
+	if !isAdmin(event.Source) {
+		return textReplyf("Only admins can change archiving.")
+	}
+	sub := strings.ToLower(args[0])
+	switch {
+	case sub == "on" || sub == "off":
+		on := sub == "on"
+		archives.update(id, func(c *chatArchive) { c.Enabled = on })
+		if on {
+			return textReplyf("🗄 From now on, images, videos, audio and files sent here are archived. /archive off stops it.")
+		}
+		return textReplyf("🗄 Archiving stopped. Saved items are kept.")
+	case (sub == "quota" || sub == "keep") && len(args) > 1:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return textReplyf("Usage: /archive %s <number>", sub)
+		}
+		archives.update(id, func(c *chatArchive) {
+			if sub == "quota" {
+				c.QuotaMB = n
+			} else {
+				c.KeepDays = n
+			}
+		})
+		go archives.expire()
+		return textReplyf("Saved. 0 means no limit.")
+	}
+	return textReplyf("Usage: /archive, /archive on|off, /archive quota <MB>, /archive keep <days>")
+}
+
+// albumCommand shows the newest archived items.
+func albumCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	c := archives.get(sourceID(event.Source))
+	if len(c.Items) == 0 {
+		return textReplyf("The album is empty. Admins can turn on archiving with /archive on.")
+	}
+	items := c.Items
+	if len(items) > albumItems {
+		items = items[len(items)-albumItems:]
+	}
+	carousel := &linebot.CarouselContainer{Type: linebot.FlexContainerTypeCarousel}
+	for i := len(items) - 1; i >= 0; i-- {
+		carousel.Contents = append(carousel.Contents, albumBubble(event.Source, items[i]))
+	}
+	return []linebot.SendingMessage{linebot.NewFlexMessage(fmt.Sprintf("%d recent items", len(items)), carousel)}
+}
+
+func albumBubble(src *linebot.EventSource, item archiveItem) *linebot.BubbleContainer {
+	title := item.FileName
+	if title == "" {
+		title = item.Type
+	}
+	bubble := &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Size: linebot.FlexBubbleSizeTypeKilo,
+		Body: &linebot.BoxComponent{
+			Type:   linebot.FlexComponentTypeBox,
+			Layout: linebot.FlexBoxLayoutTypeVertical,
+			Contents: []linebot.FlexComponent{
+				&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: title, Weight: linebot.FlexTextWeightTypeBold, Wrap: true},
+				&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: displayName(src, item.UserID), Size: linebot.FlexTextSizeTypeSm},
+				&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: item.Time.Format("2006-01-02 15:04"), Size: linebot.FlexTextSizeTypeXs, Color: "#999999"},
+			},
+		},
+	}
+	u := signedContentURL(item.Hash, albumLinkTTL)
+	if u == "" {
+		return bubble
+	}
+	if item.Type == "image" {
+		bubble.Hero = &linebot.ImageComponent{
+			Type:        linebot.FlexComponentTypeImage,
+			URL:         u,
+			Size:        linebot.FlexImageSizeTypeFull,
+			AspectMode:  linebot.FlexImageAspectModeTypeCover,
+			AspectRatio: linebot.FlexImageAspectRatioType4to3,
+		}
+	}
+	bubble.Footer = &linebot.BoxComponent{
+		Type:   linebot.FlexComponentTypeBox,
+		Layout: linebot.FlexBoxLayoutTypeVertical,
+		Contents: []linebot.FlexComponent{
+			&linebot.ButtonComponent{Type: linebot.FlexComponentTypeButton, Style: linebot.FlexButtonStyleTypeLink, Action: linebot.NewURIAction("Open", u)},
+		},
+	}
+	return bubble
+}
+
+var archivePage = template.Must(template.New("archive").Funcs(template.FuncMap{
+	"mb": func(n int64) string { return fmt.Sprintf("%.1f MB", float64(n)/(1<<20)) },
+}).Parse(`<!DOCTYPE html>
+<title>Archive</title>
+{{if .Chat}}<h1>{{.Chat}}</h1>
+<p><a href="/admin/archive">All chats</a></p>
+<table>
+<tr><th>Time</th><th>Type</th><th>Name</th><th>Sender</th><th>Size</th></tr>
+{{range .Items}}<tr><td>{{.Time.Format "2006-01-02 15:04"}}</td><td>{{.Type}}</td><td><a href="/admin/archive/file?chat={{$.Chat}}&amp;id={{.MessageID}}">{{if .FileName}}{{.FileName}}{{else}}{{.MessageID}}{{end}}</a></td><td>{{.UserID}}</td><td>{{mb .Size}}</td></tr>
+{{end}}</table>
+{{else}}<h1>Archives</h1>
+<ul>
+{{range .Chats}}<li><a href="/admin/archive?chat={{.}}">{{.}}</a></li>
+{{end}}</ul>
+{{end}}`))
+
+// archiveAdminHandler lists the archived chats, or the items of one chat.
+func archiveAdminHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Chat  string
+		Chats []string
+		Items []archiveItem
+	}{Chat: r.URL.Query().Get("chat")}
+	if data.Chat == "" {
+		data.Chats = archives.ids()
+	} else {
+		items := archives.get(data.Chat).Items
+		for i := len(items) - 1; i >= 0; i-- {
+			data.Items = append(data.Items, items[i])
+		}
+	}
+	if err := archivePage.Execute(w, data); err != nil {
+		log.Print(err)
+	}
+}
+
+// archiveFileHandler downloads an archived item under its original name.
+func archiveFileHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	for _, item := range archives.get(q.Get("chat")).Items {
+		if item.MessageID != q.Get("id") {
+			continue
+		}
+		name := item.FileName
+		if name == "" {
+			name = item.Type + "-" + item.MessageID
+		}
+		if item.ContentType != "" {
+			w.Header().Set("Content-Type", item.ContentType)
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		http.ServeFile(w, r, contentPath(item.Hash))
+		return
+	}
+	http.NotFound(w, r)
+}
@@ -0,0 +1,127 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "github.com/line/line-bot-sdk-go/v7/linebot"
+
+// botAPI is the part of the Messaging API the event handlers use. lineAPI
+// implements it over the SDK; tests use a fake that records the calls.
+type botAPI interface {
+	ReplyMessage(replyToken string, messages ...linebot.SendingMessage) error
+	PushMessage(to string, messages ...linebot.SendingMessage) error
+	GetProfile(userID string) (*linebot.UserProfileResponse, error)
+	GetGroupMemberProfile(groupID, userID string) (*linebot.UserProfileResponse, error)
+	GetRoomMemberProfile(roomID, userID string) (*linebot.UserProfileResponse, error)
+	GetGroupMemberIDs(groupID, start string) (*linebot.MemberIDsResponse, error)
+	GetRoomMemberIDs(roomID, start string) (*linebot.MemberIDsResponse, error)
+	GetGroupSummary(groupID string) (*linebot.GroupSummaryResponse, error)
+	GetGroupMemberCount(groupID string) (int, error)
+	GetRoomMemberCount(roomID string) (int, error)
+	LeaveGroup(groupID string) error
+	LeaveRoom(roomID string) error
+	GetMessageContent(messageID string) (*linebot.MessageContentResponse, error)
+	// GetMessageQuotaLeft is how many more pushes this month allows, or -1
+	// if there is no limit.
+	GetMessageQuotaLeft() (int64, error)
+}
+
+// lineAPI is the botAPI of a LINE channel.
+type lineAPI struct {
+	client *linebot.Client
+}
+
+func (a lineAPI) ReplyMessage(replyToken string, messages ...linebot.SendingMessage) error {
+	_, err := a.client.ReplyMessage(replyToken, messages...).Do()
+	return err
+}
+
+func (a lineAPI) PushMessage(to string, messages ...linebot.SendingMessage) error {
+	_, err := a.client.PushMessage(to, messages...).Do()
+	return err
+}
+
+func (a lineAPI) pushWithRetryKey(key, to string, messages ...linebot.SendingMessage) error {
+	// WithRetryKey sets the key on the client for good, so use a copy.
+	c := *a.client
+	_, err := c.PushMessage(to, messages...).WithRetryKey(key).Do()
+	return err
+}
+
+func (a lineAPI) GetProfile(userID string) (*linebot.UserProfileResponse, error) {
+	return a.client.GetProfile(userID).Do()
+}
+
+func (a lineAPI) GetGroupMemberProfile(groupID, userID string) (*linebot.UserProfileResponse, error) {
+	return a.client.GetGroupMemberProfile(groupID, userID).Do()
+}
+
+func (a lineAPI) GetRoomMemberProfile(roomID, userID string) (*linebot.UserProfileResponse, error) {
+	return a.client.GetRoomMemberProfile(roomID, userID).Do()
+}
+
+func (a lineAPI) GetGroupMemberIDs(groupID, start string) (*linebot.MemberIDsResponse, error) {
+	return a.client.GetGroupMemberIDs(groupID, start).Do()
+}
+
+func (a lineAPI) GetRoomMemberIDs(roomID, start string) (*linebot.MemberIDsResponse, error) {
+	return a.client.GetRoomMemberIDs(roomID, start).Do()
+}
+
+func (a lineAPI) GetGroupSummary(groupID string) (*linebot.GroupSummaryResponse, error) {
+	return a.client.GetGroupSummary(groupID).Do()
+}
+
+func (a lineAPI) GetGroupMemberCount(groupID string) (int, error) {
+	res, err := a.client.GetGroupMemberCount(groupID).Do()
+	if err != nil {
+		return 0, err
+	}
+	return res.Count, nil
+}
+
+func (a lineAPI) GetRoomMemberCount(roomID string) (int, error) {
+	res, err := a.client.GetRoomMemberCount(roomID).Do()
+	if err != nil {
+		return 0, err
+	}
+	return res.Count, nil
+}
+
+func (a lineAPI) LeaveGroup(groupID string) error {
+	_, err := a.client.LeaveGroup(groupID).Do()
+	return err
+}
+
+func (a lineAPI) LeaveRoom(roomID string) error {
+	_, err := a.client.LeaveRoom(roomID).Do()
+	return err
+}
+
+func (a lineAPI) GetMessageContent(messageID string) (*linebot.MessageContentResponse, error) {
+	return a.client.GetMessageContent(messageID).Do()
+}
+
+func (a lineAPI) GetMessageQuotaLeft() (int64, error) {
+	quota, err := a.client.GetMessageQuota().Do()
+	if err != nil {
+		return 0, err
+	}
+	if quota.Type == "none" {
+		return -1, nil
+	}
+	used, err := a.client.GetMessageConsumption().Do()
+	if err != nil {
+		return 0, err
+	}
+	return quota.Value - used.TotalUsage, nil
+}
@@ -0,0 +1,179 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+var errFake = errors.New("fake error")
+
+// fakeAPI is a botAPI that records every call as a line of text. Lookups
+// answer from its fields; failing makes them return errFake.
+type fakeAPI struct {
+	mu        sync.Mutex
+	calls     []string
+	lastReply []linebot.SendingMessage
+
+	profiles map[string]*linebot.UserProfileResponse
+	summary  *linebot.GroupSummaryResponse
+	count    int
+	content  string
+	quota    int64           // pushes left, -1 for no limit
+	failing  map[string]bool // method names
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{
+		profiles: map[string]*linebot.UserProfileResponse{},
+		quota:    -1,
+		failing:  map[string]bool{},
+	}
+}
+
+func (f *fakeAPI) record(format string, a ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, fmt.Sprintf(format, a...))
+}
+
+func (f *fakeAPI) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *fakeAPI) fail(method string) error {
+	if f.failing[method] {
+		return errFake
+	}
+	return nil
+}
+
+// describe renders messages compactly: text as is, images as image:<url>,
+// anything else as JSON.
+func describe(messages []linebot.SendingMessage) string {
+	var parts []string
+	for _, m := range messages {
+		switch m := m.(type) {
+		case *linebot.TextMessage:
+			parts = append(parts, m.Text)
+		case *linebot.ImageMessage:
+			parts = append(parts, "image:"+m.OriginalContentURL)
+		default:
+			b, _ := json.Marshal(m)
+			parts = append(parts, string(b))
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+func (f *fakeAPI) ReplyMessage(replyToken string, messages ...linebot.SendingMessage) error {
+	f.record("reply %s: %s", replyToken, describe(messages))
+	f.mu.Lock()
+	f.lastReply = messages
+	f.mu.Unlock()
+	return f.fail("ReplyMessage")
+}
+
+func (f *fakeAPI) PushMessage(to string, messages ...linebot.SendingMessage) error {
+	f.record("push %s: %s", to, describe(messages))
+	return f.fail("PushMessage")
+}
+
+func (f *fakeAPI) profile(method, userID string) (*linebot.UserProfileResponse, error) {
+	if err := f.fail(method); err != nil {
+		return nil, err
+	}
+	if p := f.profiles[userID]; p != nil {
+		return p, nil
+	}
+	return nil, errFake
+}
+
+func (f *fakeAPI) GetProfile(userID string) (*linebot.UserProfileResponse, error) {
+	f.record("profile %s", userID)
+	return f.profile("GetProfile", userID)
+}
+
+func (f *fakeAPI) GetGroupMemberProfile(groupID, userID string) (*linebot.UserProfileResponse, error) {
+	f.record("group profile %s %s", groupID, userID)
+	return f.profile("GetGroupMemberProfile", userID)
+}
+
+func (f *fakeAPI) GetRoomMemberProfile(roomID, userID string) (*linebot.UserProfileResponse, error) {
+	f.record("room profile %s %s", roomID, userID)
+	return f.profile("GetRoomMemberProfile", userID)
+}
+
+func (f *fakeAPI) GetGroupMemberIDs(groupID, start string) (*linebot.MemberIDsResponse, error) {
+	f.record("group members %s", groupID)
+	return nil, errFake
+}
+
+func (f *fakeAPI) GetRoomMemberIDs(roomID, start string) (*linebot.MemberIDsResponse, error) {
+	f.record("room members %s", roomID)
+	return nil, errFake
+}
+
+func (f *fakeAPI) GetGroupSummary(groupID string) (*linebot.GroupSummaryResponse, error) {
+	f.record("group summary %s", groupID)
+	if err := f.fail("GetGroupSummary"); err != nil {
+		return nil, err
+	}
+	return f.summary, nil
+}
+
+func (f *fakeAPI) GetGroupMemberCount(groupID string) (int, error) {
+	f.record("group count %s", groupID)
+	return f.count, f.fail("GetGroupMemberCount")
+}
+
+func (f *fakeAPI) GetRoomMemberCount(roomID string) (int, error) {
+	f.record("room count %s", roomID)
+	return f.count, f.fail("GetRoomMemberCount")
+}
+
+func (f *fakeAPI) LeaveGroup(groupID string) error {
+	f.record("leave group %s", groupID)
+	return f.fail("LeaveGroup")
+}
+
+func (f *fakeAPI) LeaveRoom(roomID string) error {
+	f.record("leave room %s", roomID)
+	return f.fail("LeaveRoom")
+}
+
+func (f *fakeAPI) GetMessageContent(messageID string) (*linebot.MessageContentResponse, error) {
+	f.record("content %s", messageID)
+	if err := f.fail("GetMessageContent"); err != nil {
+		return nil, err
+	}
+	return &linebot.MessageContentResponse{
+		Content:       ioutil.NopCloser(strings.NewReader(f.content)),
+		ContentLength: int64(len(f.content)),
+		ContentType:   "application/octet-stream",
+	}, nil
+}
+
+func (f *fakeAPI) GetMessageQuotaLeft() (int64, error) {
+	f.record("quota")
+	return f.quota, f.fail("GetMessageQuotaLeft")
+}
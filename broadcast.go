@@ -0,0 +1,455 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	keptBroadcasts    = 20
+	broadcastSaveEach = 20
+)
+
+// broadcastInterval spaces out the pushes of a broadcast, well below the
+// push rate limit. It is set from BroadcastRate (messages per second).
+var broadcastInterval = 200 * time.Millisecond
+
+func init() {
+	registerCommand("broadcast", broadcastCommand)
+	registerHelp("broadcast", commandHelp{
+		Summary:   "Send an announcement to all or some groups and rooms",
+		SummaryFa: "ارسال پیام به همه یا بخشی از گروه‌ها و اتاق‌ها",
+		Usage:     []string{"/broadcast dry lang:fa Maintenance tonight", "/broadcast tag:vip Hello!", "/broadcast status"},
+		Where:     inAnyChats,
+		Access:    forOperators,
+	})
+	registerSuggestions("broadcast", broadcastSuggestions)
+	registerNotification("reports")
+	registerTexts("en", map[string]string{"notify.reports": "Broadcast delivery reports"})
+	registerTexts("fa", map[string]string{"notify.reports": "گزارش ارسال پیام‌های همگانی"})
+}
+
+// broadcastFilter picks the chats a broadcast goes to. Empty fields match
+// every chat.
+type broadcastFilter struct {
+	Channel    string `json:"channel,omitempty"`
+	Language   string `json:"language,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	ActiveDays int    `json:"activeDays,omitempty"` // heard from within that many days
+}
+
+func (f broadcastFilter) matches(c chatInfo, now time.Time) bool {
+	switch {
+	case f.Channel != "" && c.Channel != f.Channel:
+		return false
+	case f.Language != "" && !strings.EqualFold(c.language(), f.Language):
+		return false
+	case f.Tag != "" && !c.hasTag(f.Tag):
+		return false
+	case f.ActiveDays > 0 && now.Sub(c.LastActive) > time.Duration(f.ActiveDays)*24*time.Hour:
+		return false
+	}
+	return true
+}
+
+func (f broadcastFilter) String() string {
+	var parts []string
+	if f.Channel != "" {
+		parts = append(parts, "channel:"+f.Channel)
+	}
+	if f.Language != "" {
+		parts = append(parts, "lang:"+f.Language)
+	}
+	if f.Tag != "" {
+		parts = append(parts, "tag:"+f.Tag)
+	}
+	if f.ActiveDays > 0 {
+		parts = append(parts, fmt.Sprintf("active:%d", f.ActiveDays))
+	}
+	if len(parts) == 0 {
+		return "all chats"
+	}
+	return strings.Join(parts, " ")
+}
+
+// set reads one key:value option, reporting whether it was one.
+func (f *broadcastFilter) set(option string) (bool, error) {
+	i := strings.Index(option, ":")
+	if i < 0 {
+		return false, nil
+	}
+	value := option[i+1:]
+	switch strings.ToLower(option[:i]) {
+	case "channel":
+		if channels[value] == nil {
+			return true, fmt.Errorf("there is no channel %q", value)
+		}
+		f.Channel = value
+	case "lang", "language":
+		f.Language = value
+	case "tag":
+		f.Tag = value
+	case "active":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return true, fmt.Errorf("active takes a number of days, not %q", value)
+		}
+		f.ActiveDays = n
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// broadcastTargets lists the chats f matches.
+func broadcastTargets(f broadcastFilter) []chatInfo {
+	now := time.Now()
+	var found []chatInfo
+	for _, c := range chats.list() {
+		if f.matches(c, now) {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// delivery is what became of a broadcast in one chat.
+type delivery struct {
+	Chat   string    `json:"chat"`
+	Status string    `json:"status"` // pending, sent or failed
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time,omitempty"`
+}
+
+// broadcast is a message pushed to many chats, with a delivery report.
+type broadcast struct {
+	ID       int             `json:"id"`
+	Text     string          `json:"text"`
+	Filter   broadcastFilter `json:"filter"`
+	By       string          `json:"by"` // user ID, or "dashboard"
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished,omitempty"`
+	Targets  []delivery      `json:"targets"`
+}
+
+// count returns how many deliveries have status.
+func (b broadcast) count(status string) int {
+	n := 0
+	for _, d := range b.Targets {
+		if d.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func (b broadcast) Sent() int    { return b.count("sent") }
+func (b broadcast) Failed() int  { return b.count("failed") }
+func (b broadcast) Pending() int { return b.count("pending") }
+
+func (b broadcast) summary() string {
+	s := fmt.Sprintf("Broadcast #%d to %s: %d sent, %d failed", b.ID, b.Filter, b.Sent(), b.Failed())
+	if n := b.Pending(); n > 0 {
+		s += fmt.Sprintf(", %d to go", n)
+	}
+	return s + "."
+}
+
+// broadcasts keeps the latest broadcasts and their reports.
+var broadcasts = &broadcastBook{}
+
+type broadcastBook struct {
+	mu   sync.Mutex
+	Last int          `json:"last"`
+	List []*broadcast `json:"list"`
+}
+
+// load reads the saved broadcasts. Ones cut short by a restart are not
+// resumed: their remaining chats are marked as failed.
+func (bb *broadcastBook) load() {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	if err := db.load("broadcasts", bb); err != nil {
+		log.Print(err)
+	}
+	for _, b := range bb.List {
+		if !b.Finished.IsZero() {
+			continue
+		}
+		for i := range b.Targets {
+			if b.Targets[i].Status == "pending" {
+				b.Targets[i].Status, b.Targets[i].Error = "failed", "interrupted by a restart"
+			}
+		}
+		b.Finished = time.Now()
+	}
+}
+
+func (bb *broadcastBook) save() {
+	if err := db.save("broadcasts", bb); err != nil {
+		log.Print(err)
+	}
+}
+
+// start records a broadcast of text to targets and sends it in the
+// background. It returns the broadcast ID.
+func (bb *broadcastBook) start(text string, f broadcastFilter, by string, targets []chatInfo) int {
+	bb.mu.Lock()
+	bb.Last++
+	b := &broadcast{ID: bb.Last, Text: text, Filter: f, By: by, Started: time.Now()}
+	for _, c := range targets {
+		b.Targets = append(b.Targets, delivery{Chat: c.ID, Status: "pending"})
+	}
+	bb.List = append(bb.List, b)
+	if len(bb.List) > keptBroadcasts {
+		bb.List = bb.List[len(bb.List)-keptBroadcasts:]
+	}
+	bb.save()
+	bb.mu.Unlock()
+	go bb.send(b)
+	return b.ID
+}
+
+// send pushes b to its chats one at a time, then reports to whoever
+// started it.
+func (bb *broadcastBook) send(b *broadcast) {
+	message := linebot.NewTextMessage(b.Text)
+	for i := range b.Targets {
+		if i > 0 {
+			time.Sleep(broadcastInterval)
+		}
+		err := pushMessage(b.Targets[i].Chat, message)
+		bb.mu.Lock()
+		d := &b.Targets[i]
+		d.Status, d.Time = "sent", time.Now()
+		if err != nil {
+			d.Status, d.Error = "failed", err.Error()
+		}
+		if i%broadcastSaveEach == broadcastSaveEach-1 {
+			bb.save()
+		}
+		bb.mu.Unlock()
+	}
+	bb.mu.Lock()
+	b.Finished = time.Now()
+	bb.save()
+	report := b.summary()
+	bb.mu.Unlock()
+	log.Print(report)
+	if strings.HasPrefix(b.By, "U") {
+		notify(b.By, "reports", linebot.NewTextMessage(report))
+	}
+}
+
+// get returns a copy of broadcast id.
+func (bb *broadcastBook) get(id int) (broadcast, bool) {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	for _, b := range bb.List {
+		if b.ID == id {
+			c := *b
+			c.Targets = append([]delivery(nil), b.Targets...)
+			return c, true
+		}
+	}
+	return broadcast{}, false
+}
+
+// list returns copies of the kept broadcasts, newest first.
+func (bb *broadcastBook) list() []broadcast {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	var list []broadcast
+	for i := len(bb.List) - 1; i >= 0; i-- {
+		c := *bb.List[i]
+		c.Targets = append([]delivery(nil), bb.List[i].Targets...)
+		list = append(list, c)
+	}
+	return list
+}
+
+// previewTargets sums up who a broadcast would reach, by channel and
+// language.
+func previewTargets(targets []chatInfo) string {
+	counts := map[string]int{}
+	for _, c := range targets {
+		lang := c.language()
+		if lang == "" {
+			lang = "no language"
+		}
+		counts[c.Channel+", "+lang]++
+	}
+	var lines []string
+	for k, n := range counts {
+		lines = append(lines, fmt.Sprintf("%s: %d", k, n))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// broadcastCommand lets bot operators message many chats:
+// /broadcast [dry] [channel:x] [lang:x] [tag:x] [active:days] text
+// /broadcast status [id]
+func broadcastCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	if !adminIDs[event.Source.UserID] {
+		return textReplyf("Only bot operators can broadcast.")
+	}
+	if len(args) > 0 && strings.EqualFold(args[0], "status") {
+		list := broadcasts.list()
+		if len(args) > 1 {
+			id, _ := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+			b, ok := broadcasts.get(id)
+			if !ok {
+				return textReplyf("There is no broadcast %s.", args[1])
+			}
+			list = []broadcast{b}
+		}
+		if len(list) == 0 {
+			return textReplyf("Nothing has been broadcast yet.")
+		}
+		return textReplyf("%s", list[0].summary())
+	}
+	var f broadcastFilter
+	dry := false
+	n := 0
+	for ; n < len(args); n++ {
+		if strings.EqualFold(args[n], "dry") {
+			dry = true
+			continue
+		}
+		ok, err := f.set(args[n])
+		if err != nil {
+			return textReplyf("%s.", err)
+		}
+		if !ok {
+			break
+		}
+	}
+	text := restText(event, n)
+	if text == "" {
+		return textReplyf("Usage: /broadcast [dry] [channel:name] [lang:code] [tag:name] [active:days] message\n/broadcast status [id]")
+	}
+	targets := broadcastTargets(f)
+	if len(targets) == 0 {
+		return textReplyf("No group or room matches %s.", f)
+	}
+	if dry {
+		return textReplyf("Dry run: %d chats match %s.\n%s", len(targets), f, previewTargets(targets))
+	}
+	id := broadcasts.start(text, f, event.Source.UserID, targets)
+	return textReplyf("Broadcast #%d is on its way to %d chats. Ask /broadcast status %d for progress.", id, len(targets), id)
+}
+
+// broadcastSuggestions offers to send a dry run for real, or to check on a
+// broadcast again.
+func broadcastSuggestions(event *linebot.Event, args []string) []linebot.QuickReplyAction {
+	if len(args) > 0 && strings.EqualFold(args[0], "status") {
+		return []linebot.QuickReplyAction{againAction("🔄 Refresh", event)}
+	}
+	var f broadcastFilter
+	command, dry, n := []string{"/broadcast"}, false, 0
+	for ; n < len(args); n++ {
+		if strings.EqualFold(args[n], "dry") {
+			dry = true
+			continue
+		}
+		ok, err := f.set(args[n])
+		if err != nil {
+			return nil
+		}
+		if !ok {
+			break
+		}
+		command = append(command, args[n])
+	}
+	if !dry || len(broadcastTargets(f)) == 0 {
+		return nil
+	}
+	return []linebot.QuickReplyAction{sendAction("📣 Send now", strings.Join(append(command, restText(event, n)), " "))}
+}
+
+// broadcastPageHandler lists the broadcasts, or shows the delivery report
+// of the one given by id.
+func broadcastPageHandler(w http.ResponseWriter, r *http.Request) {
+	if s := r.URL.Query().Get("id"); s != "" {
+		id, _ := strconv.Atoi(s)
+		b, ok := broadcasts.get(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		render(w, "broadcast.html", map[string]interface{}{"Broadcast": b})
+		return
+	}
+	renderBroadcasts(w, nil)
+}
+
+func renderBroadcasts(w http.ResponseWriter, data map[string]interface{}) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	var languages []string
+	seen := map[string]bool{}
+	for _, c := range chats.list() {
+		if lang := c.language(); lang != "" && !seen[lang] {
+			seen[lang] = true
+			languages = append(languages, lang)
+		}
+	}
+	sort.Strings(languages)
+	data["Broadcasts"] = broadcasts.list()
+	data["Channels"] = channelNames()
+	data["Languages"] = languages
+	data["CSRF"] = csrfToken()
+	render(w, "broadcasts.html", data)
+}
+
+// broadcastSendHandler previews or starts a broadcast from the dashboard.
+func broadcastSendHandler(w http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.PostFormValue("text"))
+	f := broadcastFilter{
+		Channel:  r.PostFormValue("channel"),
+		Language: r.PostFormValue("language"),
+		Tag:      strings.TrimSpace(r.PostFormValue("tag")),
+	}
+	f.ActiveDays, _ = strconv.Atoi(r.PostFormValue("active"))
+	if text == "" {
+		http.Error(w, "Empty message", http.StatusBadRequest)
+		return
+	}
+	targets := broadcastTargets(f)
+	if r.PostFormValue("dry") != "" || len(targets) == 0 {
+		var views []chatView
+		for _, c := range targets {
+			views = append(views, viewChat(c))
+		}
+		renderBroadcasts(w, map[string]interface{}{
+			"Preview": views,
+			"Filter":  f,
+			"Text":    text,
+		})
+		return
+	}
+	id := broadcasts.start(text, f, "dashboard", targets)
+	http.Redirect(w, r, "/admin/broadcast?id="+strconv.Itoa(id), http.StatusSeeOther)
+}
@@ -0,0 +1,173 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBroadcastFilter(t *testing.T) {
+	useFake(t)
+	now := time.Now()
+	c := chatInfo{ID: "G1", Channel: "test", Language: "fa", Tags: []string{"Ops"}, LastActive: now.Add(-48 * time.Hour)}
+	tests := []struct {
+		filter broadcastFilter
+		want   bool
+	}{
+		{broadcastFilter{}, true},
+		{broadcastFilter{Channel: "test"}, true},
+		{broadcastFilter{Channel: "other"}, false},
+		{broadcastFilter{Language: "FA"}, true},
+		{broadcastFilter{Language: "en"}, false},
+		{broadcastFilter{Tag: "ops"}, true},
+		{broadcastFilter{Tag: "vip"}, false},
+		{broadcastFilter{ActiveDays: 3}, true},
+		{broadcastFilter{ActiveDays: 1}, false},
+		{broadcastFilter{Language: "fa", Tag: "vip"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.matches(c, now); got != tt.want {
+			t.Errorf("%s matches = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+// waitForBroadcast waits until broadcast id has been sent everywhere.
+func waitForBroadcast(t *testing.T, id int) broadcast {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if b, _ := broadcasts.get(id); !b.Finished.IsZero() {
+			return b
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("broadcast %d did not finish", id)
+	return broadcast{}
+}
+
+func TestBroadcastCommand(t *testing.T) {
+	f := useFake(t)
+	broadcastInterval = 0
+	adminIDs["U1"] = true
+	chats.Chats = map[string]*chatInfo{}
+	defer func() {
+		delete(adminIDs, "U1")
+		chats.Chats = map[string]*chatInfo{}
+	}()
+	chats.seen(defaultChannel, inGroup)
+	chats.seen(defaultChannel, inRoom)
+	chats.setProfile("G1", "fa", []string{"ops"})
+
+	tests := []struct {
+		name  string
+		text  string
+		reply string
+		sends []string
+	}{
+		{"usage", "/broadcast", "Usage: /broadcast", nil},
+		{"bad option", "/broadcast active:soon hi", "active takes a number of days", nil},
+		{"no match", "/broadcast tag:vip hi", "No group or room matches tag:vip", nil},
+		{"dry run", "/broadcast dry lang:fa Maintenance tonight", "Dry run: 1 chats match lang:fa", nil},
+		{"tagged", "/broadcast tag:ops Maintenance\ntonight", "is on its way to 1 chats", []string{"push G1: Maintenance\ntonight"}},
+		{"everyone", "/broadcast Back online", "is on its way to 2 chats", []string{"push G1: Back online", "push R1: Back online"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.calls = nil
+			dispatchCommand(f, textEvent(inChat, tt.text), tt.text)
+			calls := f.Calls()
+			if len(calls) == 0 || !strings.Contains(calls[0], tt.reply) {
+				t.Fatalf("reply %v, want %q", calls, tt.reply)
+			}
+			if tt.sends == nil {
+				return
+			}
+			b := waitForBroadcast(t, broadcasts.Last)
+			if b.Sent() != len(tt.sends) || b.Failed() != 0 {
+				t.Errorf("report: %s", b.summary())
+			}
+			calls = f.Calls()[1:]
+			want := append(tt.sends, "push U1: Broadcast #")
+			if len(calls) != len(want) {
+				t.Fatalf("calls %q, want %q", calls, want)
+			}
+			for _, w := range want {
+				found := false
+				for _, c := range calls {
+					found = found || strings.HasPrefix(c, w)
+				}
+				if !found {
+					t.Errorf("no call %q in %q", w, calls)
+				}
+			}
+		})
+	}
+
+	f.calls = nil
+	dispatchCommand(f, textEvent(inChat, "/broadcast status"), "/broadcast status")
+	checkCalls(t, f.Calls(), []string{"2 sent, 0 failed."})
+
+	delete(adminIDs, "U1")
+	f.calls = nil
+	dispatchCommand(f, textEvent(inGroup, "/broadcast hi"), "/broadcast hi")
+	checkCalls(t, f.Calls(), []string{"Only bot operators"})
+}
+
+func TestBroadcastDashboard(t *testing.T) {
+	f := useFake(t)
+	broadcastInterval = 0
+	adminToken = "secret-token"
+	chats.Chats = map[string]*chatInfo{}
+	defer func() {
+		adminToken = ""
+		chats.Chats = map[string]*chatInfo{}
+	}()
+	chats.seen(defaultChannel, inGroup)
+	chats.seen(defaultChannel, inRoom)
+	f.failing["PushMessage"] = true
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		form.Set("csrf", csrfToken())
+		r := httptest.NewRequest("POST", "/admin/broadcast/send", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("admin", adminToken)
+		w := httptest.NewRecorder()
+		requireAdmin(postOnly(broadcastSendHandler))(w, r)
+		return w
+	}
+	w := post(url.Values{"text": {"hi"}, "dry": {"1"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "2 chats match all chats") {
+		t.Fatalf("preview: %d %s", w.Code, w.Body)
+	}
+	w = post(url.Values{"text": {"hi"}, "active": {"1"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("send: %d %s", w.Code, w.Body)
+	}
+	b := waitForBroadcast(t, broadcasts.Last)
+	if b.Failed() != 2 || b.Targets[0].Error != errFake.Error() {
+		t.Errorf("report: %s %v", b.summary(), b.Targets)
+	}
+
+	r := httptest.NewRequest("GET", w.Header().Get("Location"), nil)
+	r.SetBasicAuth("admin", adminToken)
+	w = httptest.NewRecorder()
+	requireAdmin(broadcastPageHandler)(w, r)
+	if !strings.Contains(w.Body.String(), "0 sent, 2 failed, 0 to go") {
+		t.Errorf("report page:\n%s", w.Body)
+	}
+}
@@ -0,0 +1,201 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// channel is one LINE bot served by this process, at /callback/<name>.
+type channel struct {
+	Name     string   `json:"name"`
+	Secret   string   `json:"secret"`
+	Token    string   `json:"token"`
+	Language string   `json:"language"`
+	Features []string `json:"features"` // enabled commands, all if empty
+
+	// Instead of a token: the channel ID, the key ID and private key file of
+	// an assertion signing key, and the lifetime of the tokens to issue.
+	ChannelID  string `json:"channelId"`
+	KeyID      string `json:"keyId"`
+	PrivateKey string `json:"privateKey"`
+	TokenHours int    `json:"tokenHours"`
+
+	client *linebot.Client
+	api    botAPI
+	key    *rsa.PrivateKey
+}
+
+// allows tells whether command is enabled on the channel.
+func (c *channel) allows(command string) bool {
+	if len(c.Features) == 0 {
+		return true
+	}
+	for _, f := range c.Features {
+		if strings.EqualFold(strings.TrimPrefix(f, "/"), command) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	channels       = map[string]*channel{}
+	defaultChannel *channel
+	cliChannel     *channel // the channel subcommands work on
+)
+
+// loadChannels sets up the channels listed in the JSON file path, or a single
+// channel from ChannelSecret and ChannelAccessToken if path is empty. The
+// first channel also answers at /callback and is the one bot points at.
+// Secrets, tokens and key files may name environment variables, as in
+// "$PROD_TOKEN".
+func loadChannels(path string) error {
+	list := []*channel{{
+		Name:       "default",
+		Secret:     os.Getenv("ChannelSecret"),
+		Token:      os.Getenv("ChannelAccessToken"),
+		ChannelID:  os.Getenv("ChannelID"),
+		KeyID:      os.Getenv("AssertionKeyID"),
+		PrivateKey: os.Getenv("AssertionPrivateKey"),
+	}}
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		list = nil
+		if err := json.Unmarshal(b, &list); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if len(list) == 0 {
+			return fmt.Errorf("%s: no channels", path)
+		}
+	}
+	for _, c := range list {
+		if c.Name == "" || strings.Contains(c.Name, "/") || channels[c.Name] != nil {
+			return fmt.Errorf("channel names must be unique and not contain /: %q", c.Name)
+		}
+		c.Secret, c.Token, c.PrivateKey = os.ExpandEnv(c.Secret), os.ExpandEnv(c.Token), os.ExpandEnv(c.PrivateKey)
+		var err error
+		if c.rotates() {
+			c.client, err = c.rotatingClient()
+		} else {
+			c.client, err = linebot.New(c.Secret, c.Token)
+		}
+		if err != nil {
+			return fmt.Errorf("channel %s: %v", c.Name, err)
+		}
+		c.api = cachedAPI{newLimitedAPI(lineAPI{c.client})}
+		channels[c.Name] = c
+	}
+	defaultChannel, cliChannel = list[0], list[0]
+	bot = defaultChannel.client
+	return nil
+}
+
+// selectChannel points bot at the named channel, for the subcommands.
+func selectChannel(name string) error {
+	c := channels[name]
+	if c == nil {
+		return errors.New("no channel " + name)
+	}
+	cliChannel, bot = c, c.client
+	return nil
+}
+
+// channelNames lists the channels by name, sorted.
+func channelNames() []string {
+	var names []string
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// channelByPath finds the channel of a webhook request path.
+func channelByPath(path string) *channel {
+	name := strings.Trim(strings.TrimPrefix(path, "/callback"), "/")
+	if name == "" {
+		return defaultChannel
+	}
+	return channels[name]
+}
+
+// chatChannels remembers which channel each group, room and user talks to, so
+// that pushes and lookups outside of a webhook use the right client.
+var chatChannels = &chatChannelBook{Chats: map[string]string{}}
+
+type chatChannelBook struct {
+	mu    sync.Mutex
+	Chats map[string]string `json:"chats"`
+}
+
+func (b *chatChannelBook) load() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := db.load("channels", b); err != nil {
+		log.Print(err)
+	}
+}
+
+// bind records that src reached the bot through channel c.
+func (b *chatChannelBook) bind(c *channel, src *linebot.EventSource) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	changed := false
+	for _, id := range []string{sourceID(src), src.UserID} {
+		if id != "" && b.Chats[id] != c.Name {
+			b.Chats[id] = c.Name
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := db.save("channels", b); err != nil {
+		log.Print(err)
+	}
+}
+
+// channelFor is the channel of a group, room or user, by default the first.
+func channelFor(id string) *channel {
+	chatChannels.mu.Lock()
+	defer chatChannels.mu.Unlock()
+	if c := channels[chatChannels.Chats[id]]; c != nil {
+		return c
+	}
+	return defaultChannel
+}
+
+// clientFor is the API to reach a group, room or user with.
+func clientFor(id string) botAPI {
+	return channelFor(id).api
+}
+
+// botFor is the API to answer an event from src with.
+func botFor(src *linebot.EventSource) botAPI {
+	return clientFor(sourceID(src))
+}
@@ -0,0 +1,278 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	eventLogSize   = 200
+	chatActiveSave = time.Hour
+)
+
+// chatInfo is a group or room the bot is in.
+type chatInfo struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"` // group or room
+	Channel    string    `json:"channel"`
+	Joined     time.Time `json:"joined"`
+	LastActive time.Time `json:"lastActive"`
+	Disabled   []string  `json:"disabled,omitempty"` // commands turned off here
+	Language   string    `json:"language,omitempty"` // instead of the channel's
+	Tags       []string  `json:"tags,omitempty"`
+	Left       time.Time `json:"left,omitempty"`   // zero while the bot is in it
+	Purged     bool      `json:"purged,omitempty"` // content deleted after leaving
+}
+
+// language is the language of the chat, by default its channel's.
+func (c chatInfo) language() string {
+	if c.Language != "" {
+		return c.Language
+	}
+	if ch := channels[c.Channel]; ch != nil {
+		return ch.Language
+	}
+	return ""
+}
+
+func (c chatInfo) hasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// chats lists the groups and rooms the bot is or was in. Chats from before
+// it was kept are added when they are next heard from.
+var chats = &chatBook{Chats: map[string]*chatInfo{}}
+
+type chatBook struct {
+	mu    sync.Mutex
+	Chats map[string]*chatInfo `json:"chats"`
+}
+
+func (b *chatBook) load() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := db.load("chats", b); err != nil {
+		log.Print(err)
+	}
+}
+
+func (b *chatBook) save() {
+	if err := db.save("chats", b); err != nil {
+		log.Print(err)
+	}
+}
+
+// seen adds the group or room of src, reached through channel c, or notes
+// that it is active. Activity is saved at most hourly.
+func (b *chatBook) seen(c *channel, src *linebot.EventSource) {
+	now := time.Now()
+	info := chatInfo{Type: "group", ID: src.GroupID, Channel: c.Name, Joined: now, LastActive: now}
+	if src.GroupID == "" {
+		info.Type, info.ID = "room", src.RoomID
+	}
+	if info.ID == "" {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if old := b.Chats[info.ID]; old != nil {
+		last := old.LastActive
+		old.LastActive = now
+		if now.Sub(last) < chatActiveSave {
+			return
+		}
+	} else {
+		b.Chats[info.ID] = &info
+	}
+	b.save()
+}
+
+// join adds chat id reached through channel c, or brings back a chat the
+// bot left with its settings. It reports whether the bot had been in it
+// before.
+func (b *chatBook) join(c *channel, id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	info := b.Chats[id]
+	rejoined := info != nil && !info.Left.IsZero()
+	if info == nil {
+		info = &chatInfo{ID: id, Type: "group"}
+		if strings.HasPrefix(id, "R") {
+			info.Type = "room"
+		}
+		b.Chats[id] = info
+	}
+	info.Channel, info.Joined, info.LastActive = c.Name, now, now
+	info.Left, info.Purged = time.Time{}, false
+	b.save()
+	return rejoined
+}
+
+// leave notes that the bot left chat id.
+func (b *chatBook) leave(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.Chats[id]; c != nil {
+		c.Left = time.Now()
+		b.save()
+	}
+}
+
+// purged notes that the content of chat id was deleted.
+func (b *chatBook) purged(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.Chats[id]; c != nil {
+		c.Purged = true
+		b.save()
+	}
+}
+
+func (b *chatBook) get(id string) (chatInfo, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.Chats[id]; c != nil {
+		return *c, true
+	}
+	return chatInfo{}, false
+}
+
+// list returns the chats the bot is in, most recently joined first.
+func (b *chatBook) list() []chatInfo {
+	return b.filter(func(c *chatInfo) bool { return c.Left.IsZero() })
+}
+
+// gone returns the chats the bot left, most recently joined first.
+func (b *chatBook) gone() []chatInfo {
+	return b.filter(func(c *chatInfo) bool { return !c.Left.IsZero() })
+}
+
+func (b *chatBook) filter(keep func(c *chatInfo) bool) []chatInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var list []chatInfo
+	for _, c := range b.Chats {
+		if keep(c) {
+			list = append(list, *c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Joined.After(list[j].Joined) })
+	return list
+}
+
+// allows tells whether command is turned on in chat id.
+func (b *chatBook) allows(id, command string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.Chats[id]; c != nil {
+		for _, d := range c.Disabled {
+			if d == command {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// setDisabled replaces the commands turned off in chat id.
+func (b *chatBook) setDisabled(id string, commands []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.Chats[id]; c != nil {
+		sort.Strings(commands)
+		c.Disabled = commands
+		b.save()
+	}
+}
+
+// setProfile changes the language and tags of chat id.
+func (b *chatBook) setProfile(id, language string, tags []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.Chats[id]; c != nil {
+		c.Language, c.Tags = language, tags
+		b.save()
+	}
+}
+
+// loggedEvent is a webhook event as shown on the dashboard. Message texts
+// are not kept, except for commands.
+type loggedEvent struct {
+	Time    time.Time
+	Channel string
+	Chat    string
+	UserID  string
+	Type    string
+}
+
+// recentEvents keeps the latest webhook events in memory.
+var recentEvents = &eventLog{}
+
+type eventLog struct {
+	mu   sync.Mutex
+	list []loggedEvent
+}
+
+func (l *eventLog) add(c *channel, event *linebot.Event) {
+	e := loggedEvent{Time: event.Timestamp, Channel: c.Name, Type: string(event.Type)}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if event.Source != nil {
+		e.Chat, e.UserID = sourceID(event.Source), event.Source.UserID
+	}
+	switch m := event.Message.(type) {
+	case *linebot.TextMessage:
+		e.Type += " text"
+		if fields := strings.Fields(m.Text); len(fields) > 0 && strings.HasPrefix(fields[0], "/") {
+			e.Type += " " + fields[0]
+		}
+	case linebot.Message:
+		name := strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", m), "*linebot."), "Message")
+		e.Type += " " + strings.ToLower(name)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.list = append(l.list, e)
+	if len(l.list) > eventLogSize {
+		l.list = l.list[len(l.list)-eventLogSize:]
+	}
+}
+
+// recent returns the latest events of chat id, or of all chats if id is
+// empty, newest first.
+func (l *eventLog) recent(id string, n int) []loggedEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []loggedEvent
+	for i := len(l.list) - 1; i >= 0 && len(found) < n; i-- {
+		if id == "" || l.list[i].Chat == id {
+			found = append(found, l.list[i])
+		}
+	}
+	return found
+}
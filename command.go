@@ -0,0 +1,156 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// commandFunc handles a slash command and returns the messages to reply with.
+type commandFunc func(event *linebot.Event, args []string) []linebot.SendingMessage
+
+var commands = map[string]commandFunc{}
+
+// registerCommand makes /name available in every chat.
+func registerCommand(name string, fn commandFunc) {
+	commands[name] = fn
+}
+
+// dispatchCommand runs the registered command text starts with and replies
+// with its messages through api, the channel that received event. It reports
+// whether text was a registered command.
+func dispatchCommand(api botAPI, event *linebot.Event, text string) bool {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return false
+	}
+	name := strings.ToLower(fields[0][1:])
+	fn, ok := commands[name]
+	id := sourceID(event.Source)
+	if !ok || !channelFor(id).allows(name) || !chats.allows(id, name) {
+		return false
+	}
+	messages := fn(event, fields[1:])
+	if len(messages) == 0 {
+		return true
+	}
+	if more := suggestions[name]; more != nil && !hasQuickReplies(messages[len(messages)-1]) {
+		messages = suggest(messages, more(event, fields[1:])...)
+	}
+	if err := api.ReplyMessage(event.ReplyToken, messages...); err != nil {
+		log.Print(err)
+	}
+	return true
+}
+
+// textReplyf is the common case of a command answering with one text message.
+func textReplyf(format string, a ...interface{}) []linebot.SendingMessage {
+	return []linebot.SendingMessage{linebot.NewTextMessage(fmt.Sprintf(format, a...))}
+}
+
+// messageHook sees a message event and api, the channel that received it.
+// Replies and message content must go through that channel.
+type messageHook func(api botAPI, event *linebot.Event)
+
+var messageHooks []messageHook
+
+// registerMessageHook makes fn see every message event before commands run.
+func registerMessageHook(fn messageHook) {
+	messageHooks = append(messageHooks, fn)
+}
+
+func runMessageHooks(api botAPI, event *linebot.Event) {
+	for _, fn := range messageHooks {
+		fn(api, event)
+	}
+}
+
+// postbackFunc handles the data of a postback button the bot sent and returns
+// the messages to reply with.
+type postbackFunc func(event *linebot.Event, data url.Values) []linebot.SendingMessage
+
+var postbacks = map[string]postbackFunc{}
+
+// registerPostback routes postbacks whose data has "a=name" to fn.
+func registerPostback(name string, fn postbackFunc) {
+	postbacks[name] = fn
+}
+
+// dispatchPostback runs the handler named by the postback data and replies
+// with its messages through api, the channel that received event.
+func dispatchPostback(api botAPI, event *linebot.Event) {
+	if strings.HasPrefix(event.Postback.Data, "/") {
+		// Rich menu areas can run commands directly.
+		dispatchCommand(api, event, event.Postback.Data)
+		return
+	}
+	data, err := url.ParseQuery(event.Postback.Data)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	fn, ok := postbacks[data.Get("a")]
+	if !ok {
+		log.Printf("Unknown postback: %q", event.Postback.Data)
+		return
+	}
+	messages := fn(event, data)
+	if len(messages) == 0 {
+		return
+	}
+	if err := api.ReplyMessage(event.ReplyToken, messages...); err != nil {
+		log.Print(err)
+	}
+}
+
+// pushMessage sends messages to a user, group or room outside of a reply.
+func pushMessage(to string, messages ...linebot.SendingMessage) error {
+	err := clientFor(to).PushMessage(to, messages...)
+	if err != nil {
+		log.Print(err)
+	}
+	return err
+}
+
+// truncate shortens s to at most n characters, marking the cut with "…".
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// restText returns the text of a command message after the command and its
+// first n arguments, keeping line breaks that args loses.
+func restText(event *linebot.Event, n int) string {
+	message, ok := event.Message.(*linebot.TextMessage)
+	if !ok {
+		return ""
+	}
+	text := strings.TrimSpace(message.Text)
+	for i := 0; i <= n; i++ {
+		j := strings.IndexFunc(text, unicode.IsSpace)
+		if j < 0 {
+			return ""
+		}
+		text = strings.TrimLeftFunc(text[j:], unicode.IsSpace)
+	}
+	return strings.TrimRightFunc(text, unicode.IsSpace)
+}
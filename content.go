@@ -0,0 +1,159 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message content such as images is downloaded from LINE and kept under
+// DataDir/content, named by its SHA-256 so that each file is stored once.
+// It is served on /content/<hash> because LINE fetches the images the bot
+// sends from a public HTTPS URL. Only note images are served as they are;
+// anything else, such as archived media, needs a signed link that expires.
+
+// publicURL is the HTTPS base URL of this bot, from PublicURL.
+var publicURL string
+
+// contentKey signs content links. It is made once and kept in DataDir, so
+// that links stay good across restarts.
+var contentKey struct {
+	Key []byte `json:"key"`
+}
+
+// loadContentKey reads the key that signs content links, or makes one.
+func loadContentKey() {
+	if err := db.load("contentkey", &contentKey); err != nil {
+		log.Print(err)
+	}
+	if len(contentKey.Key) > 0 {
+		return
+	}
+	contentKey.Key = make([]byte, 32)
+	if _, err := rand.Read(contentKey.Key); err != nil {
+		log.Fatal(err)
+	}
+	if err := db.save("contentkey", &contentKey); err != nil {
+		log.Print(err)
+	}
+}
+
+// contentSignature signs hash until expires.
+func contentSignature(hash string, expires int64) string {
+	mac := hmac.New(sha256.New, contentKey.Key)
+	fmt.Fprintf(mac, "%s %d", hash, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func contentPath(hash string) string {
+	return filepath.Join(db.dir, "content", hash[:2], hash)
+}
+
+// saveContent stores the data read from r and returns its hash and size.
+func saveContent(r io.Reader) (string, int64, error) {
+	dir := filepath.Join(db.dir, "content")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := ioutil.TempFile(dir, "upload")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	p := contentPath(hash)
+	if _, err := os.Stat(p); err == nil {
+		return hash, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", 0, err
+	}
+	return hash, size, os.Rename(tmp.Name(), p)
+}
+
+// fetchContent downloads the content of a message received through api into
+// the store.
+func fetchContent(api botAPI, messageID string) (hash, contentType string, size int64, err error) {
+	res, err := api.GetMessageContent(messageID)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer res.Content.Close()
+	hash, size, err = saveContent(res.Content)
+	return hash, res.ContentType, size, err
+}
+
+// contentURL is the public URL of a note image, or "" when PublicURL is not
+// configured.
+func contentURL(hash string) string {
+	if publicURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(publicURL, "/") + "/content/" + hash
+}
+
+// signedContentURL is a link to any stored content that works for ttl, or
+// "" when PublicURL is not configured.
+func signedContentURL(hash string, ttl time.Duration) string {
+	u := contentURL(hash)
+	if u == "" {
+		return ""
+	}
+	expires := time.Now().Add(ttl).Unix()
+	return fmt.Sprintf("%s?expires=%d&sig=%s", u, expires, contentSignature(hash, expires))
+}
+
+// signedFor reports whether r carries a good signature for hash that has
+// not expired.
+func signedFor(r *http.Request, hash string) bool {
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(q.Get("sig")), []byte(contentSignature(hash, expires)))
+}
+
+func contentHandler(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimPrefix(r.URL.Path, "/content/")
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+		http.NotFound(w, r)
+		return
+	}
+	if !notebook.references(hash) && !signedFor(r, hash) {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, contentPath(hash))
+}
@@ -0,0 +1,77 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContentAccess(t *testing.T) {
+	publicURL = "https://bot.example"
+	loadContentKey()
+	defer func() {
+		publicURL = ""
+		notebook.Chats = map[string]*chatNotes{}
+		archives.Chats = map[string]*chatArchive{}
+	}()
+	noteImage, _, err := saveContent(strings.NewReader("note image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived, _, err := saveContent(strings.NewReader("archived video"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notebook.Chats = map[string]*chatNotes{"G1": {Notes: map[string]*note{"wifi": {Image: noteImage}}}}
+	archives.Chats = map[string]*chatArchive{"G1": {Items: []archiveItem{{MessageID: "M7", Type: "file", FileName: "گزارش سالانه.pdf", Hash: archived}}}}
+
+	get := func(u string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(u, publicURL), nil)
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/content/") {
+				contentHandler(w, r)
+			} else {
+				archiveFileHandler(w, r)
+			}
+		}).ServeHTTP(w, r)
+		return w
+	}
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"note image", contentURL(noteImage), http.StatusOK},
+		{"archived item without a signature", contentURL(archived), http.StatusNotFound},
+		{"archived item with a signature", signedContentURL(archived, time.Hour), http.StatusOK},
+		{"expired link", signedContentURL(archived, -time.Minute), http.StatusNotFound},
+		{"signature of another item", strings.Replace(signedContentURL(noteImage, time.Hour), noteImage, archived, 1), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if got := get(tt.url).Code; got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	w := get("/admin/archive/file?chat=G1&id=M7")
+	_, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+	if err != nil || params["filename"] != "گزارش سالانه.pdf" {
+		t.Errorf("Content-Disposition %q gives %q, %v", w.Header().Get("Content-Disposition"), params["filename"], err)
+	}
+}
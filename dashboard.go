@@ -0,0 +1,294 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var dashboardPages = template.Must(template.New("").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "–"
+		}
+		return t.Format("2006-01-02 15:04")
+	},
+	"join": strings.Join,
+}).ParseFS(templateFiles, "templates/*.html"))
+
+// job is a background task shown on the dashboard.
+type job struct {
+	Name string
+	Last time.Time
+	Next time.Time
+}
+
+var jobs = struct {
+	sync.Mutex
+	list map[string]*job
+}{list: map[string]*job{}}
+
+// scheduled records that the background task name ran at last and runs
+// again at next. A zero last keeps the previous one.
+func scheduled(name string, last, next time.Time) {
+	jobs.Lock()
+	defer jobs.Unlock()
+	j := jobs.list[name]
+	if j == nil {
+		j = &job{Name: name}
+		jobs.list[name] = j
+	}
+	if !last.IsZero() {
+		j.Last = last
+	}
+	j.Next = next
+}
+
+func jobList() []job {
+	jobs.Lock()
+	defer jobs.Unlock()
+	var list []job
+	for _, j := range jobs.list {
+		list = append(list, *j)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Next.Before(list[j].Next) })
+	return list
+}
+
+// csrfToken guards the dashboard forms: browsers resend basic authentication
+// on their own, so other sites could otherwise post them.
+func csrfToken() string {
+	sum := sha256.Sum256([]byte("csrf " + adminToken))
+	return hex.EncodeToString(sum[:])
+}
+
+func postOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(csrfToken())) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// chatView is a chat with what LINE tells about it.
+type chatView struct {
+	chatInfo
+	Name    string
+	Picture string
+	Members int
+}
+
+// chatViewTTL is how long what LINE tells about a chat is reused, so that
+// dashboard loads and broadcast previews do not call LINE for every chat.
+const chatViewTTL = 10 * time.Minute
+
+type cachedView struct {
+	view    chatView
+	fetched time.Time
+}
+
+var chatViews = struct {
+	sync.Mutex
+	views map[string]cachedView
+}{views: map[string]cachedView{}}
+
+// viewChat tells what LINE knows about chat c, from the cache if it is fresh.
+func viewChat(c chatInfo) chatView {
+	chatViews.Lock()
+	cached, ok := chatViews.views[c.ID]
+	chatViews.Unlock()
+	if ok && time.Since(cached.fetched) < chatViewTTL {
+		cached.view.chatInfo = c
+		return cached.view
+	}
+	v := fetchChatView(c)
+	chatViews.Lock()
+	chatViews.views[c.ID] = cachedView{view: v, fetched: time.Now()}
+	chatViews.Unlock()
+	return v
+}
+
+func fetchChatView(c chatInfo) chatView {
+	v := chatView{chatInfo: c, Name: c.ID, Members: -1}
+	api := clientFor(c.ID)
+	var err error
+	if c.Type == "group" {
+		var summary *linebot.GroupSummaryResponse
+		if summary, err = api.GetGroupSummary(c.ID); err == nil {
+			v.Name, v.Picture = summary.GroupName, summary.PictureURL
+		}
+		if n, err := api.GetGroupMemberCount(c.ID); err == nil {
+			v.Members = n
+		}
+	} else {
+		v.Name = "Room " + truncate(c.ID, 10)
+		if n, err := api.GetRoomMemberCount(c.ID); err == nil {
+			v.Members = n
+		}
+	}
+	if err != nil {
+		log.Print(err)
+	}
+	return v
+}
+
+func render(w http.ResponseWriter, name string, data interface{}) {
+	if err := dashboardPages.ExecuteTemplate(w, name, data); err != nil {
+		log.Print(err)
+	}
+}
+
+// dashboardHandler lists the chats, background jobs and latest events.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	var views []chatView
+	for _, c := range chats.list() {
+		views = append(views, viewChat(c))
+	}
+	render(w, "dashboard.html", map[string]interface{}{
+		"Chats":  views,
+		"Gone":   chats.gone(),
+		"Jobs":   jobList(),
+		"Events": recentEvents.recent("", 50),
+	})
+}
+
+// chatPageHandler shows one chat with its settings and actions.
+func chatPageHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := chats.get(r.URL.Query().Get("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	ch := channelFor(c.ID)
+	type feature struct {
+		Name      string
+		On        bool
+		Available bool
+	}
+	var features []feature
+	for _, name := range commandNames() {
+		features = append(features, feature{name, chats.allows(c.ID, name), ch.allows(name)})
+	}
+	render(w, "chat.html", map[string]interface{}{
+		"Chat":            viewChat(c),
+		"Features":        features,
+		"ChannelLanguage": ch.Language,
+		"Events":          recentEvents.recent(c.ID, 50),
+		"History":         lifecycle.of(c.ID),
+		"CSRF":            csrfToken(),
+		"Message":         r.URL.Query().Get("m"),
+	})
+}
+
+func backToChat(w http.ResponseWriter, r *http.Request, id, message string) {
+	http.Redirect(w, r, "/admin/chat?id="+url.QueryEscape(id)+"&m="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+func chatFeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("id")
+	if _, ok := chats.get(id); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var disabled []string
+	for _, name := range commandNames() {
+		if r.PostFormValue("on-"+name) == "" {
+			disabled = append(disabled, name)
+		}
+	}
+	chats.setDisabled(id, disabled)
+	backToChat(w, r, id, "Features saved.")
+}
+
+// chatProfileHandler sets the language and tags that broadcasts filter on.
+func chatProfileHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("id")
+	if _, ok := chats.get(id); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var tags []string
+	for _, tag := range strings.Split(r.PostFormValue("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	chats.setProfile(id, strings.TrimSpace(r.PostFormValue("language")), tags)
+	backToChat(w, r, id, "Language and tags saved.")
+}
+
+func chatPushHandler(w http.ResponseWriter, r *http.Request) {
+	id, text := r.PostFormValue("id"), strings.TrimSpace(r.PostFormValue("text"))
+	if _, ok := chats.get(id); !ok || text == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if err := pushMessage(id, linebot.NewTextMessage(text)); err != nil {
+		backToChat(w, r, id, "Sending failed: "+err.Error())
+		return
+	}
+	backToChat(w, r, id, "Message sent.")
+}
+
+func chatLeaveHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("id")
+	c, ok := chats.get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var err error
+	if c.Type == "group" {
+		err = clientFor(id).LeaveGroup(id)
+	} else {
+		err = clientFor(id).LeaveRoom(id)
+	}
+	if err != nil {
+		backToChat(w, r, id, "Leaving failed: "+err.Error())
+		return
+	}
+	left(id, "dashboard")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// commandNames lists the registered commands, sorted.
+func commandNames() []string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,94 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	f := useFake(t)
+	adminToken = "secret-token"
+	defer func() {
+		adminToken = ""
+		chats.Chats = map[string]*chatInfo{}
+	}()
+	chats.seen(defaultChannel, inGroup)
+	recentEvents.add(defaultChannel, textEvent(inGroup, "/roll 1d6"))
+	csrf := csrfToken()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		form   url.Values
+		status int
+		body   string
+		calls  []string
+	}{
+		{"dashboard", "GET", "/admin", nil, http.StatusOK, "Friends", []string{"group summary G1", "group count G1"}},
+		{"chat page", "GET", "/admin/chat?id=G1", nil, http.StatusOK, "message text /roll", nil}, // cached
+		{"unknown chat", "GET", "/admin/chat?id=G2", nil, http.StatusNotFound, "", nil},
+		{"push without token", "POST", "/admin/chat/push", url.Values{"id": {"G1"}, "text": {"hi"}}, http.StatusForbidden, "", nil},
+		{"push with GET", "GET", "/admin/chat/push?id=G1&text=hi", nil, http.StatusMethodNotAllowed, "", nil},
+		{"push", "POST", "/admin/chat/push", url.Values{"csrf": {csrf}, "id": {"G1"}, "text": {"Maintenance tonight"}}, http.StatusSeeOther, "", []string{"push G1: Maintenance tonight"}},
+		{"features", "POST", "/admin/chat/features", url.Values{"csrf": {csrf}, "id": {"G1"}, "on-flip": {"1"}}, http.StatusSeeOther, "", nil},
+		{"features kept", "GET", "/admin/chat?id=G1", nil, http.StatusOK, `name="on-flip" value="1" checked`, nil},
+		{"leave", "POST", "/admin/chat/leave", url.Values{"csrf": {csrf}, "id": {"G1"}}, http.StatusSeeOther, "", []string{"leave group G1"}},
+	}
+	handlers := map[string]http.HandlerFunc{
+		"/admin":               requireAdmin(dashboardHandler),
+		"/admin/chat":          requireAdmin(chatPageHandler),
+		"/admin/chat/features": requireAdmin(postOnly(chatFeaturesHandler)),
+		"/admin/chat/push":     requireAdmin(postOnly(chatPushHandler)),
+		"/admin/chat/leave":    requireAdmin(postOnly(chatLeaveHandler)),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.calls = nil
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.form.Encode()))
+			if tt.form != nil {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			r.SetBasicAuth("admin", adminToken)
+			w := httptest.NewRecorder()
+			handlers[r.URL.Path](w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("page does not contain %q:\n%s", tt.body, w.Body)
+			}
+			checkCalls(t, f.Calls(), tt.calls)
+			if tt.name == "features" && (chats.allows("G1", "roll") || !chats.allows("G1", "flip")) {
+				t.Error("only /flip should be on")
+			}
+		})
+	}
+
+	if c, _ := chats.get("G1"); c.Left.IsZero() || len(chats.list()) != 0 {
+		t.Error("G1 is still listed after leaving")
+	}
+
+	r := httptest.NewRequest("GET", "/admin", nil)
+	r.SetBasicAuth("admin", "wrong")
+	w := httptest.NewRecorder()
+	requireAdmin(dashboardHandler)(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status %d", w.Code)
+	}
+}
@@ -0,0 +1,555 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	digestHour     = 20
+	digestCheck    = 10 * time.Minute
+	digestTop      = 3
+	digestReserved = 100 // pushes left for everything but digests
+)
+
+// digestSections are the parts a digest can have, in order.
+var digestSections = []string{"activity", "members", "links"}
+
+func init() {
+	registerCommand("digest", digestCommand)
+	registerHelp("digest", commandHelp{
+		Summary:    "Show the digest settings, or a preview of the next digest. It covers activity, members and links; this bot has no polls, events or reminders to report",
+		SummaryFa:  "تنظیمات خلاصه‌ی روزانه یا هفتگی گروه، یا پیش‌نمایش خلاصه‌ی بعدی. شامل فعالیت، اعضا و لینک‌هاست؛ این ربات نظرسنجی، رویداد یا یادآوری ندارد",
+		Usage:      []string{"/digest", "/digest now"},
+		AdminUsage: []string{"/digest daily 21", "/digest weekly fri 18", "/digest hide links", "/digest show links", "/digest off"},
+		Where:      inShared,
+	})
+	registerMessageHook(digestHook)
+}
+
+// chatDigest holds the digest settings of one group or room and what
+// happened since the last digest. Digests are off until an admin turns
+// them on.
+type chatDigest struct {
+	Schedule string          `json:"schedule,omitempty"` // daily or weekly
+	Hour     int             `json:"hour"`
+	Weekday  time.Weekday    `json:"weekday"`
+	Hidden   map[string]bool `json:"hidden,omitempty"` // sections left out
+	Since    time.Time       `json:"since"`            // start of this digest
+
+	Messages int               `json:"messages"`
+	Active   map[string]int    `json:"active,omitempty"` // messages by user
+	Joined   []string          `json:"joined,omitempty"`
+	Left     map[string]string `json:"left,omitempty"` // names by user, as far as known
+	Links    map[string]int    `json:"links,omitempty"`
+}
+
+// next is when the digest started at since is due.
+func (c *chatDigest) next(since time.Time) time.Time {
+	t := time.Date(since.Year(), since.Month(), since.Day(), c.Hour, 0, 0, 0, time.Local)
+	if !t.After(since) {
+		t = t.AddDate(0, 0, 1)
+	}
+	for c.Schedule == "weekly" && t.Weekday() != c.Weekday {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// reset starts a new digest at now.
+func (c *chatDigest) reset(now time.Time) {
+	c.Since, c.Messages, c.Active, c.Joined, c.Left, c.Links = now, 0, nil, nil, nil, nil
+}
+
+func (c *chatDigest) String() string {
+	at := fmt.Sprintf("%02d:00", c.Hour)
+	switch c.Schedule {
+	case "daily":
+		return "daily at " + at
+	case "weekly":
+		return "weekly on " + c.Weekday.String() + "s at " + at
+	}
+	return "off"
+}
+
+// digests holds the digest of every group and room.
+var digests = &digestBook{Chats: map[string]*chatDigest{}}
+
+type digestBook struct {
+	mu    sync.Mutex
+	saved time.Time
+	Chats map[string]*chatDigest `json:"chats"`
+}
+
+func (d *digestBook) load() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := db.load("digest", d); err != nil {
+		log.Print(err)
+	}
+}
+
+// save writes the book out, at once if force is set and otherwise at most
+// once a minute. d.mu must be held.
+func (d *digestBook) save(force bool) {
+	if !force && time.Since(d.saved) < time.Minute {
+		return
+	}
+	d.saved = time.Now()
+	if err := db.save("digest", d); err != nil {
+		log.Print(err)
+	}
+}
+
+// copy returns c with maps of its own, so that it can be read while the
+// hooks keep counting.
+func (c *chatDigest) copy() chatDigest {
+	copied := *c
+	copied.Hidden = copyHidden(c.Hidden)
+	copied.Active = copyCounts(c.Active)
+	copied.Links = copyCounts(c.Links)
+	copied.Joined = append([]string(nil), c.Joined...)
+	if c.Left != nil {
+		copied.Left = make(map[string]string, len(c.Left))
+		for userID, name := range c.Left {
+			copied.Left[userID] = name
+		}
+	}
+	return copied
+}
+
+func copyHidden(hidden map[string]bool) map[string]bool {
+	if hidden == nil {
+		return nil
+	}
+	copied := make(map[string]bool, len(hidden))
+	for section, hide := range hidden {
+		copied[section] = hide
+	}
+	return copied
+}
+
+// update changes the digest of chat id with fn and saves it.
+func (d *digestBook) update(id string, fn func(c *chatDigest)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.Chats[id]
+	if c == nil {
+		c = &chatDigest{Hour: digestHour, Weekday: time.Friday}
+		d.Chats[id] = c
+	}
+	fn(c)
+	d.save(true)
+}
+
+// get returns a copy of the digest of chat id, without the counts.
+func (d *digestBook) get(id string) chatDigest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c := d.Chats[id]; c != nil {
+		return chatDigest{Schedule: c.Schedule, Hour: c.Hour, Weekday: c.Weekday, Hidden: copyHidden(c.Hidden), Since: c.Since}
+	}
+	return chatDigest{Hour: digestHour, Weekday: time.Friday}
+}
+
+// counted returns a copy of the digest of chat id so far, if it has one.
+func (d *digestBook) counted(id string) (chatDigest, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.Chats[id]
+	if c == nil || c.Schedule == "" {
+		return chatDigest{}, false
+	}
+	return c.copy(), true
+}
+
+// record lets fn count something in the digest of chat id, if it has one.
+func (d *digestBook) record(id string, fn func(c *chatDigest)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c := d.Chats[id]; c != nil && c.Schedule != "" {
+		fn(c)
+		d.save(false)
+	}
+}
+
+// joined and left count members who came and went.
+func (d *digestBook) joined(id string, userIDs []string) {
+	d.record(id, func(c *chatDigest) { c.Joined = append(c.Joined, userIDs...) })
+}
+
+func (d *digestBook) left(id, userID, name string) {
+	d.record(id, func(c *chatDigest) {
+		if c.Left == nil {
+			c.Left = map[string]string{}
+		}
+		c.Left[userID] = name
+	})
+}
+
+// forgetChat drops what was counted in chat id, but keeps its settings.
+func (d *digestBook) forgetChat(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c := d.Chats[id]; c != nil {
+		c.reset(time.Now())
+		d.save(true)
+	}
+}
+
+// digestHook counts the messages of chats that have a digest, leaving out
+// commands.
+func digestHook(api botAPI, event *linebot.Event) {
+	if event.Source.Type == linebot.EventSourceTypeUser {
+		return
+	}
+	var urls []string
+	if m, ok := event.Message.(*linebot.TextMessage); ok {
+		if strings.HasPrefix(m.Text, "/") {
+			return
+		}
+		urls = extractURLs(m.Text)
+	}
+	digests.record(sourceID(event.Source), func(c *chatDigest) {
+		c.Messages++
+		if event.Source.UserID != "" {
+			if c.Active == nil {
+				c.Active = map[string]int{}
+			}
+			c.Active[event.Source.UserID]++
+		}
+		for _, u := range urls {
+			if c.Links == nil {
+				c.Links = map[string]int{}
+			}
+			c.Links[u]++
+		}
+	})
+}
+
+// digestLines are the rows of each section of the digest c of the chat of
+// src. Sections with nothing to tell are left out.
+func digestLines(src *linebot.EventSource, c *chatDigest) map[string][]string {
+	lines := map[string][]string{}
+	if c.Messages > 0 {
+		activity := []string{fmt.Sprintf("%d messages", c.Messages)}
+		for i, userID := range top(c.Active, digestTop) {
+			activity = append(activity, fmt.Sprintf("%d. %s (%d)", i+1, displayName(src, userID), c.Active[userID]))
+		}
+		lines["activity"] = activity
+	}
+	var members []string
+	if len(c.Joined) > 0 {
+		var names []string
+		for _, userID := range c.Joined {
+			names = append(names, displayName(src, userID))
+		}
+		members = append(members, "👋 New: "+strings.Join(names, ", "))
+	}
+	if len(c.Left) > 0 {
+		var names []string
+		unknown := 0
+		for _, name := range c.Left {
+			if name != "" {
+				names = append(names, name)
+			} else {
+				unknown++
+			}
+		}
+		sort.Strings(names)
+		if unknown > 0 {
+			names = append(names, fmt.Sprintf("%d more", unknown))
+		}
+		members = append(members, "🚪 Left: "+strings.Join(names, ", "))
+	}
+	if len(members) > 0 {
+		lines["members"] = members
+	}
+	for _, u := range top(c.Links, digestTop) {
+		lines["links"] = append(lines["links"], fmt.Sprintf("%s (%d×)", truncate(u, 60), c.Links[u]))
+	}
+	return lines
+}
+
+var digestTitles = map[string]string{
+	"activity": "💬 Activity",
+	"members":  "👥 Members",
+	"links":    "🔗 Top links",
+}
+
+// digestMessage renders the digest c of the chat of src until now, or is
+// nil if there is nothing to tell.
+func digestMessage(src *linebot.EventSource, c *chatDigest, now time.Time) linebot.SendingMessage {
+	lines := digestLines(src, c)
+	title := "📅 Daily digest"
+	if c.Schedule == "weekly" {
+		title = "📅 Weekly digest"
+	}
+	period := c.Since.Format("Jan 2 15:04") + " – " + now.Format("Jan 2 15:04")
+	body := []linebot.FlexComponent{
+		&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: title, Weight: linebot.FlexTextWeightTypeBold, Size: linebot.FlexTextSizeTypeLg},
+		&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: period, Size: linebot.FlexTextSizeTypeXs, Color: "#999999"},
+	}
+	alt := []string{title}
+	for _, section := range digestSections {
+		if c.Hidden[section] || len(lines[section]) == 0 {
+			continue
+		}
+		body = append(body, &linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: digestTitles[section], Weight: linebot.FlexTextWeightTypeBold, Size: linebot.FlexTextSizeTypeSm, Margin: linebot.FlexComponentMarginTypeLg})
+		for _, line := range lines[section] {
+			body = append(body, &linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: line, Size: linebot.FlexTextSizeTypeSm, Wrap: true})
+		}
+		alt = append(alt, lines[section][0])
+	}
+	if len(alt) == 1 {
+		return nil
+	}
+	bubble := &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Body: &linebot.BoxComponent{Type: linebot.FlexComponentTypeBox, Layout: linebot.FlexBoxLayoutTypeVertical, Contents: body},
+	}
+	return linebot.NewFlexMessage(truncate(strings.Join(alt, " · "), maxAltText), bubble)
+}
+
+// dueDigest is a digest ready to be pushed, with the counts it tells.
+type dueDigest struct {
+	id      string
+	message linebot.SendingMessage
+	counted chatDigest
+}
+
+// takeDue renders the digests due at now and starts the next ones.
+// Digests with nothing to tell are skipped. Those that cannot be sent go
+// back with putBack.
+func (d *digestBook) takeDue(now time.Time) []dueDigest {
+	type chat struct {
+		id string
+		c  chatDigest
+	}
+	var ready []chat
+	d.mu.Lock()
+	for id, c := range d.Chats {
+		if c.Schedule == "" || now.Before(c.next(c.Since)) {
+			continue
+		}
+		ready = append(ready, chat{id, c.copy()})
+		c.reset(now)
+	}
+	if len(ready) > 0 {
+		d.save(true)
+	}
+	d.mu.Unlock()
+	sort.Slice(ready, func(i, j int) bool { return ready[i].id < ready[j].id })
+	var due []dueDigest
+	for _, r := range ready {
+		// Name lookups happen outside the lock.
+		if m := digestMessage(chatSource(r.id), &r.c, now); m != nil {
+			due = append(due, dueDigest{r.id, m, r.c})
+		}
+	}
+	return due
+}
+
+// putBack adds the counts of a digest that could not be sent to those
+// counted since, so that it is tried again with nothing lost.
+func (d *digestBook) putBack(id string, old chatDigest) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.Chats[id]
+	if c == nil || c.Schedule == "" {
+		return
+	}
+	c.Since = old.Since
+	c.Messages += old.Messages
+	for userID, n := range old.Active {
+		if c.Active == nil {
+			c.Active = map[string]int{}
+		}
+		c.Active[userID] += n
+	}
+	for u, n := range old.Links {
+		if c.Links == nil {
+			c.Links = map[string]int{}
+		}
+		c.Links[u] += n
+	}
+	for userID, name := range old.Left {
+		if c.Left == nil {
+			c.Left = map[string]string{}
+		}
+		c.Left[userID] = name
+	}
+	c.Joined = append(old.Joined, c.Joined...)
+	d.save(true)
+}
+
+// chatSource is an event source for chat id, to look up its members.
+func chatSource(id string) *linebot.EventSource {
+	if strings.HasPrefix(id, "R") {
+		return &linebot.EventSource{Type: linebot.EventSourceTypeRoom, RoomID: id}
+	}
+	return &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: id}
+}
+
+// deliverDigests pushes the digests due at now, as far as each channel's
+// push quota allows after keeping digestReserved pushes for other uses.
+// It tells how many it sent.
+func deliverDigests(now time.Time) int {
+	byChannel := map[*channel][]dueDigest{}
+	for _, due := range digests.takeDue(now) {
+		ch := channelFor(due.id)
+		byChannel[ch] = append(byChannel[ch], due)
+	}
+	sent := 0
+	for ch, due := range byChannel {
+		left, err := clientFor(due[0].id).GetMessageQuotaLeft()
+		if err == nil && left >= 0 && left-digestReserved < int64(len(due)) {
+			err = fmt.Errorf("only %d pushes left this month", left)
+		}
+		if err != nil {
+			log.Printf("Not sending %d digests of %s: %v", len(due), ch.Name, err)
+			for _, dd := range due {
+				digests.putBack(dd.id, dd.counted)
+			}
+			continue
+		}
+		for _, dd := range due {
+			if pushMessage(dd.id, dd.message) != nil {
+				digests.putBack(dd.id, dd.counted)
+				continue
+			}
+			sent++
+		}
+	}
+	return sent
+}
+
+// sendDigests checks for due digests every digestCheck.
+func sendDigests() {
+	for {
+		deliverDigests(time.Now())
+		scheduled("Group digests", time.Now(), time.Now().Add(digestCheck))
+		time.Sleep(digestCheck)
+	}
+}
+
+// parseHour reads an hour like 21 or 21:00.
+func parseHour(s string) (int, bool) {
+	s = strings.TrimSuffix(s, ":00")
+	h, err := strconv.Atoi(s)
+	return h, err == nil && h >= 0 && h < 24
+}
+
+// parseWeekday reads a day of the week by its first three letters or more.
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(s)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if name := strings.ToLower(d.String()); len(s) >= 3 && strings.HasPrefix(name, s) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+func digestCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	if event.Source.GroupID == "" && event.Source.RoomID == "" {
+		return textReplyf("/digest only works in a group or room.")
+	}
+	id := sourceID(event.Source)
+	c := digests.get(id)
+	sub := ""
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	switch sub {
+	case "":
+		if c.Schedule == "" {
+			return textReplyf("📅 The digest is off. Admins can turn it on with /digest daily or /digest weekly.")
+		}
+		var shown []string
+		for _, section := range digestSections {
+			if !c.Hidden[section] {
+				shown = append(shown, section)
+			}
+		}
+		return textReplyf("📅 The digest comes %s with %s. Next: %s.", c.String(), strings.Join(shown, ", "), c.next(c.Since).Format("Mon Jan 2 15:04"))
+	case "now":
+		soFar, ok := digests.counted(id)
+		if !ok {
+			return textReplyf("📅 The digest is off. Admins can turn it on with /digest daily or /digest weekly.")
+		}
+		m := digestMessage(event.Source, &soFar, time.Now())
+		if m == nil {
+			return textReplyf("📅 Nothing to tell yet.")
+		}
+		return []linebot.SendingMessage{m}
+	}
+	if !isAdmin(event.Source) {
+		return textReplyf("Only admins can change the digest.")
+	}
+	usage := "Usage: /digest daily [hour], /digest weekly [day] [hour], /digest show|hide <section>, /digest off"
+	switch sub {
+	case "off":
+		digests.update(id, func(c *chatDigest) {
+			c.Schedule = ""
+			c.reset(time.Time{})
+		})
+		return textReplyf("📅 The digest is off.")
+	case "daily", "weekly":
+		hour, weekday := c.Hour, c.Weekday
+		for _, arg := range args[1:] {
+			if h, ok := parseHour(arg); ok {
+				hour = h
+			} else if d, ok := parseWeekday(arg); ok && sub == "weekly" {
+				weekday = d
+			} else {
+				return textReplyf("%s", usage)
+			}
+		}
+		var settings string
+		digests.update(id, func(c *chatDigest) {
+			if c.Schedule == "" {
+				c.reset(time.Now())
+			}
+			c.Schedule, c.Hour, c.Weekday = sub, hour, weekday
+			settings = c.String()
+		})
+		return textReplyf("📅 The digest comes %s from now on: messages, the most active members, who came and went and the top links. /digest now shows it so far.", settings)
+	case "show", "hide":
+		if len(args) != 2 || !hasString(digestSections, strings.ToLower(args[1])) {
+			return textReplyf("Sections: %s", strings.Join(digestSections, ", "))
+		}
+		section := strings.ToLower(args[1])
+		digests.update(id, func(c *chatDigest) {
+			if c.Hidden == nil {
+				c.Hidden = map[string]bool{}
+			}
+			if sub == "hide" {
+				c.Hidden[section] = true
+			} else {
+				delete(c.Hidden, section)
+			}
+		})
+		return textReplyf("Saved.")
+	}
+	return textReplyf("%s", usage)
+}
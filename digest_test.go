@@ -0,0 +1,176 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestNextDigest(t *testing.T) {
+	// 2026-10-14 is a Wednesday.
+	at := func(day, hour, min int) time.Time { return time.Date(2026, 10, day, hour, min, 0, 0, time.Local) }
+	tests := []struct {
+		digest chatDigest
+		since  time.Time
+		want   time.Time
+	}{
+		{chatDigest{Schedule: "daily", Hour: 20}, at(14, 9, 30), at(14, 20, 0)},
+		{chatDigest{Schedule: "daily", Hour: 20}, at(14, 20, 0), at(15, 20, 0)},
+		{chatDigest{Schedule: "daily", Hour: 8}, at(14, 21, 0), at(15, 8, 0)},
+		{chatDigest{Schedule: "weekly", Hour: 18, Weekday: time.Friday}, at(14, 9, 0), at(16, 18, 0)},
+		{chatDigest{Schedule: "weekly", Hour: 18, Weekday: time.Wednesday}, at(14, 18, 5), at(21, 18, 0)},
+	}
+	for _, tt := range tests {
+		if got := tt.digest.next(tt.since); !got.Equal(tt.want) {
+			t.Errorf("%s since %s: next at %s, want %s", tt.digest.String(), tt.since, got, tt.want)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	f := useFake(t)
+	f.profiles["U2"] = &linebot.UserProfileResponse{UserID: "U2", DisplayName: "Bob"}
+	// Names of members who left come from the cache.
+	profiles.Entries[profileKey("G1", "U2")] = profileEntry{Profile: f.profiles["U2"], Fetched: time.Now()}
+	digests.Chats = map[string]*chatDigest{}
+	defer func() {
+		digests.Chats = map[string]*chatDigest{}
+		profiles.Entries = map[string]profileEntry{}
+		admins.set("G1", "U1", false)
+	}()
+	bob := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: "U2"}
+	run := func(text string, want string) {
+		t.Helper()
+		f.calls = nil
+		handleEvent(f, textEvent(inGroup, text))
+		calls := f.Calls()
+		if len(calls) == 0 || !strings.Contains(calls[len(calls)-1], want) {
+			t.Errorf("%s: got %q, want a reply with %q", text, calls, want)
+		}
+	}
+
+	handleEvent(f, textEvent(bob, "not counted yet"))
+	run("/digest", "The digest is off")
+	run("/digest daily", "Only admins")
+	admins.set("G1", "U1", true)
+	run("/digest weekly someday", "Usage:")
+	run("/digest weekly fri 18", "weekly on Fridays at 18:00")
+	run("/digest", "with activity, members, links")
+	run("/digest now", "Nothing to tell yet.")
+
+	handleEvent(f, textEvent(bob, "look at https://example.com/picnic"))
+	handleEvent(f, textEvent(bob, "again https://example.com/picnic!"))
+	handleEvent(f, textEvent(inGroup, "nice"))
+	handleEvent(f, &linebot.Event{Type: linebot.EventTypeMemberJoined, ReplyToken: "T", Source: inGroup, Members: []*linebot.EventSource{{UserID: "U3"}}})
+	handleEvent(f, &linebot.Event{Type: linebot.EventTypeMemberLeft, Source: inGroup, Members: []*linebot.EventSource{{UserID: "U2"}}})
+	run("/digest now", "Weekly digest · 3 messages · 👋 New:")
+	run("/digest now", `"text":"1. Bob (2)"`)
+	run("/digest now", `"text":"🚪 Left: Bob"`)
+	run("/digest now", `"text":"https://example.com/picnic (2×)"`)
+	run("/digest hide links", "Saved.")
+	f.calls = nil
+	handleEvent(f, textEvent(inGroup, "/digest now"))
+	if calls := f.Calls(); strings.Contains(calls[len(calls)-1], "Top links") {
+		t.Errorf("hidden links are shown: %q", calls)
+	}
+	run("/digest show dice", "Sections: activity, members, links")
+
+	// Nothing is sent before time. When the quota is short or the push
+	// fails, the digest keeps its counts for the next try.
+	since := digests.Chats["G1"].Since
+	due := digests.Chats["G1"].next(since)
+	f.calls = nil
+	if n := deliverDigests(due.Add(-time.Minute)); n != 0 {
+		t.Errorf("%d digests sent early", n)
+	}
+	f.quota = digestReserved
+	if n := deliverDigests(due); n != 0 {
+		t.Errorf("%d digests sent without quota", n)
+	}
+	if calls := f.Calls(); calls[len(calls)-1] != "quota" {
+		t.Errorf("got calls %q", calls)
+	}
+	if c := digests.Chats["G1"]; c.Messages != 3 || !c.Since.Equal(since) || c.Active["U2"] != 2 || c.Left["U2"] != "Bob" {
+		t.Errorf("after a skipped digest: %+v", c)
+	}
+
+	f.quota = -1
+	f.failing["PushMessage"] = true
+	handleEvent(f, textEvent(inGroup, "hello"))
+	if n := deliverDigests(due); n != 0 {
+		t.Errorf("%d digests sent while pushes fail", n)
+	}
+	if c := digests.Chats["G1"]; c.Messages != 4 || !c.Since.Equal(since) || len(c.Joined) != 1 || c.Links["https://example.com/picnic"] != 2 {
+		t.Errorf("after a failed push: %+v", c)
+	}
+
+	f.failing["PushMessage"] = false
+	f.calls = nil
+	if n := deliverDigests(due); n != 1 {
+		t.Errorf("%d digests sent", n)
+	}
+	calls := f.Calls()
+	if len(calls) < 2 || !strings.Contains(calls[len(calls)-1], `push G1: {"type":"flex","altText":"📅 Weekly digest · 4 messages · `) {
+		t.Errorf("got calls %q", calls)
+	}
+	if c := digests.Chats["G1"]; c.Messages != 0 || !c.Since.Equal(due) {
+		t.Errorf("after the digest: %+v", c)
+	}
+
+	// A quiet week sends nothing.
+	f.calls = nil
+	if n := deliverDigests(digests.Chats["G1"].next(due)); n != 0 {
+		t.Errorf("%d digests sent for a quiet week", n)
+	}
+	run("/digest off", "The digest is off.")
+}
+
+func TestDigestCopies(t *testing.T) {
+	f := useFake(t)
+	digests.Chats = map[string]*chatDigest{"G1": {Schedule: "daily", Hour: 20, Since: time.Now()}}
+	defer func() { digests.Chats = map[string]*chatDigest{} }()
+	// The hooks keep counting while digests are read; -race tells if the
+	// copies share their maps.
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			digestHook(f, textEvent(inGroup, "see https://example.com/"+strconv.Itoa(i)))
+			digests.joined("G1", []string{"U3"})
+			digests.left("G1", "U"+strconv.Itoa(i), "Bob")
+			digests.update("G1", func(c *chatDigest) {
+				if c.Hidden == nil {
+					c.Hidden = map[string]bool{}
+				}
+				c.Hidden["links"] = i%2 == 0
+			})
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if c, ok := digests.counted("G1"); ok {
+			digestLines(inGroup, &c)
+		}
+		c := digests.get("G1")
+		_ = c.Hidden["links"]
+	}
+}
@@ -1,5 +1,5 @@
 module github.com/kkdai/linebot-group
 
-go 1.14
+go 1.16
 
 require github.com/line/line-bot-sdk-go/v7 v7.9.1
@@ -0,0 +1,288 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// /help is built from what each command registers with registerHelp, so a
+// new command shows up in it as soon as it is registered.
+
+const (
+	helpPerBubble = 6
+	helpMaxPages  = 12 // LINE allows 12 bubbles in a carousel
+	maxAltText    = 400
+)
+
+// chatKinds says where a command works.
+type chatKinds int
+
+const (
+	inGroups chatKinds = 1 << iota
+	inRooms
+	inPrivate
+
+	inShared   = inGroups | inRooms
+	inAnyChats = inShared | inPrivate
+)
+
+// access says who may run a command.
+type access int
+
+const (
+	forMembers access = iota
+	forAdmins
+	forOperators
+)
+
+// commandHelp describes a command for /help.
+type commandHelp struct {
+	Summary    string   // in English
+	SummaryFa  string   // in Persian
+	Usage      []string // examples anyone can run
+	AdminUsage []string // examples only admins can run
+	Where      chatKinds
+	Access     access
+}
+
+var helps = map[string]commandHelp{}
+
+// registerHelp describes /name for /help.
+func registerHelp(name string, h commandHelp) {
+	helps[name] = h
+	registerTexts("en", map[string]string{"about." + name: h.Summary})
+	registerTexts("fa", map[string]string{"about." + name: h.SummaryFa})
+}
+
+func init() {
+	registerCommand("help", helpCommand)
+	registerHelp("help", commandHelp{
+		Summary:   "List the commands you can use here, or explain one",
+		SummaryFa: "فهرست دستورهای قابل استفاده در اینجا، یا توضیح یکی از آنها",
+		Usage:     []string{"/help", "/help roll"},
+		Where:     inAnyChats,
+	})
+	// /me and /bye are answered by handleEvent itself.
+	registerHelp("me", commandHelp{
+		Summary:   "Show your name and picture",
+		SummaryFa: "نمایش نام و تصویر شما",
+		Usage:     []string{"/me"},
+		Where:     inShared,
+	})
+	registerHelp("bye", commandHelp{
+		Summary:   "Make the bot leave this chat",
+		SummaryFa: "خارج کردن ربات از این گفتگو",
+		Usage:     []string{"/bye"},
+		Where:     inShared,
+	})
+	registerSuggestions("help", helpSuggestions)
+	registerTexts("en", map[string]string{
+		"help.title":     "Commands",
+		"help.page":      "%d/%d",
+		"help.alt":       "Commands: %s",
+		"help.examples":  "Examples",
+		"help.admins":    "Admins also",
+		"help.where":     "Works in: %s",
+		"help.groups":    "groups",
+		"help.rooms":     "rooms",
+		"help.chat":      "one-on-one chats",
+		"help.foradmins": "Only admins can run it.",
+		"help.operators": "Only bot operators can run it.",
+		"help.none":      "There is no /%s here. Send /help for the list.",
+		"help.empty":     "No commands are turned on here.",
+	})
+	registerTexts("fa", map[string]string{
+		"help.title":     "دستورها",
+		"help.alt":       "دستورها: %s",
+		"help.examples":  "نمونه‌ها",
+		"help.admins":    "برای مدیران",
+		"help.where":     "قابل استفاده در: %s",
+		"help.groups":    "گروه‌ها",
+		"help.rooms":     "اتاق‌ها",
+		"help.chat":      "گفتگوی خصوصی",
+		"help.foradmins": "فقط مدیران می‌توانند آن را اجرا کنند.",
+		"help.operators": "فقط گردانندگان ربات می‌توانند آن را اجرا کنند.",
+		"help.none":      "دستور /%s اینجا وجود ندارد. برای فهرست، /help را بفرستید.",
+		"help.empty":     "هیچ دستوری اینجا روشن نیست.",
+	})
+}
+
+// helpSuggestions keeps the one-on-one chat buttons under /help there.
+func helpSuggestions(event *linebot.Event, args []string) []linebot.QuickReplyAction {
+	if event.Source.Type != linebot.EventSourceTypeUser {
+		return nil
+	}
+	lang := chatLanguage(event.Source)
+	return []linebot.QuickReplyAction{
+		sendAction(tr(lang, "button.mygroups"), "/mygroups"),
+		sendAction(tr(lang, "button.settings"), "/settings"),
+	}
+}
+
+// callerAccess is the most src.UserID may run.
+func callerAccess(src *linebot.EventSource) access {
+	switch {
+	case adminIDs[src.UserID]:
+		return forOperators
+	case isAdmin(src):
+		return forAdmins
+	}
+	return forMembers
+}
+
+// kindOf is the kind of chat src is.
+func kindOf(src *linebot.EventSource) chatKinds {
+	switch src.Type {
+	case linebot.EventSourceTypeGroup:
+		return inGroups
+	case linebot.EventSourceTypeRoom:
+		return inRooms
+	}
+	return inPrivate
+}
+
+// usable tells whether the caller of src can run /name where src is.
+func usable(src *linebot.EventSource, name string) bool {
+	h, ok := helps[name]
+	if !ok || h.Where&kindOf(src) == 0 || h.Access > callerAccess(src) {
+		return false
+	}
+	if _, ok := commands[name]; ok {
+		id := sourceID(src)
+		return channelFor(id).allows(name) && chats.allows(id, name)
+	}
+	return true
+}
+
+// usableCommands lists the commands the caller of src can run there.
+func usableCommands(src *linebot.EventSource) []string {
+	var names []string
+	for name := range helps {
+		if usable(src, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func helpCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	lang := chatLanguage(event.Source)
+	if len(args) > 0 {
+		name := strings.ToLower(strings.TrimPrefix(args[0], "/"))
+		if !usable(event.Source, name) {
+			return textReplyf("%s", tr(lang, "help.none", name))
+		}
+		h := helps[name]
+		bubble := commandBubble(lang, name, h, callerAccess(event.Source) >= forAdmins)
+		return []linebot.SendingMessage{linebot.NewFlexMessage(truncate("/"+name+": "+tr(lang, "about."+name), maxAltText), bubble)}
+	}
+	names := usableCommands(event.Source)
+	if len(names) == 0 {
+		return textReplyf("%s", tr(lang, "help.empty"))
+	}
+	return []linebot.SendingMessage{helpCarousel(lang, names)}
+}
+
+// helpCarousel pages names through a carousel; tapping one explains it.
+func helpCarousel(lang string, names []string) linebot.SendingMessage {
+	pages := (len(names) + helpPerBubble - 1) / helpPerBubble
+	if pages > helpMaxPages {
+		pages = helpMaxPages
+	}
+	carousel := &linebot.CarouselContainer{Type: linebot.FlexContainerTypeCarousel}
+	for p := 0; p < pages; p++ {
+		page := names[p*helpPerBubble:]
+		if len(page) > helpPerBubble {
+			page = page[:helpPerBubble]
+		}
+		title := tr(lang, "help.title")
+		if pages > 1 {
+			title += " · " + tr(lang, "help.page", p+1, pages)
+		}
+		rows := []linebot.FlexComponent{
+			&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: title, Weight: linebot.FlexTextWeightTypeBold, Size: linebot.FlexTextSizeTypeLg},
+		}
+		for _, name := range page {
+			rows = append(rows, &linebot.BoxComponent{
+				Type:   linebot.FlexComponentTypeBox,
+				Layout: linebot.FlexBoxLayoutTypeVertical,
+				Margin: linebot.FlexComponentMarginTypeMd,
+				Action: linebot.NewMessageAction("/"+name, "/help "+name),
+				Contents: []linebot.FlexComponent{
+					&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: "/" + name, Weight: linebot.FlexTextWeightTypeBold, Color: "#1DB446"},
+					&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: tr(lang, "about."+name), Size: linebot.FlexTextSizeTypeSm, Wrap: true},
+				},
+			})
+		}
+		carousel.Contents = append(carousel.Contents, &linebot.BubbleContainer{
+			Type: linebot.FlexContainerTypeBubble,
+			Body: &linebot.BoxComponent{Type: linebot.FlexComponentTypeBox, Layout: linebot.FlexBoxLayoutTypeVertical, Contents: rows},
+		})
+	}
+	slashed := make([]string, len(names))
+	for i, name := range names {
+		slashed[i] = "/" + name
+	}
+	return linebot.NewFlexMessage(truncate(tr(lang, "help.alt", strings.Join(slashed, " ")), maxAltText), carousel)
+}
+
+// commandBubble explains /name with examples that run when tapped.
+func commandBubble(lang, name string, h commandHelp, admin bool) *linebot.BubbleContainer {
+	small := func(text string) linebot.FlexComponent {
+		return &linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: text, Size: linebot.FlexTextSizeTypeSm, Color: "#999999", Wrap: true, Margin: linebot.FlexComponentMarginTypeMd}
+	}
+	example := func(usage string) linebot.FlexComponent {
+		return &linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: usage, Color: "#1DB446", Wrap: true, Action: linebot.NewMessageAction(quickReplyLabel(usage), usage)}
+	}
+	contents := []linebot.FlexComponent{
+		&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: "/" + name, Weight: linebot.FlexTextWeightTypeBold, Size: linebot.FlexTextSizeTypeLg},
+		&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: tr(lang, "about."+name), Wrap: true},
+	}
+	if len(h.Usage) > 0 {
+		contents = append(contents, small(tr(lang, "help.examples")))
+		for _, usage := range h.Usage {
+			contents = append(contents, example(usage))
+		}
+	}
+	if admin && len(h.AdminUsage) > 0 {
+		contents = append(contents, small(tr(lang, "help.admins")))
+		for _, usage := range h.AdminUsage {
+			contents = append(contents, example(usage))
+		}
+	}
+	var where []string
+	for _, k := range []struct {
+		kind chatKinds
+		key  string
+	}{{inGroups, "help.groups"}, {inRooms, "help.rooms"}, {inPrivate, "help.chat"}} {
+		if h.Where&k.kind != 0 {
+			where = append(where, tr(lang, k.key))
+		}
+	}
+	contents = append(contents, small(tr(lang, "help.where", strings.Join(where, ", "))))
+	switch h.Access {
+	case forAdmins:
+		contents = append(contents, small(tr(lang, "help.foradmins")))
+	case forOperators:
+		contents = append(contents, small(tr(lang, "help.operators")))
+	}
+	return &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Body: &linebot.BoxComponent{Type: linebot.FlexComponentTypeBox, Layout: linebot.FlexBoxLayoutTypeVertical, Contents: contents},
+	}
+}
@@ -0,0 +1,93 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEveryCommandHasHelp(t *testing.T) {
+	for _, name := range commandNames() {
+		if _, ok := helps[name]; !ok {
+			t.Errorf("/%s has no help", name)
+		}
+	}
+	for name, h := range helps {
+		if h.Summary == "" || h.SummaryFa == "" || len(h.Usage) == 0 || h.Where == 0 {
+			t.Errorf("/%s has incomplete help: %+v", name, h)
+		}
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	f := useFake(t)
+	chats.Chats = map[string]*chatInfo{}
+	defer func() {
+		chats.Chats = map[string]*chatInfo{}
+		admins.set("G1", "U1", false)
+	}()
+	chats.seen(defaultChannel, inGroup)
+	chats.setDisabled("G1", []string{"quiz"})
+
+	tests := []struct {
+		text   string
+		admin  bool
+		want   []string
+		absent []string
+	}{
+		{"/help", false, []string{"/bye /digest /distance", "/roll", "Commands · 1/"}, []string{"/quiz", "/broadcast", "/mygroups", "quickReply"}},
+		{"/help /roll", false, []string{`"altText":"/roll: Roll dice"`, `"text":"/roll 2d6"`, "Works in: groups, rooms, one-on-one chats"}, nil},
+		{"/help archive", false, []string{"/archive", "Works in: groups, rooms"}, []string{"/archive quota"}},
+		{"/help archive", true, []string{"Admins also", `"text":"/archive quota 100"`}, nil},
+		{"/help quiz", false, []string{"reply T: There is no /quiz here."}, nil},
+		{"/help broadcast", true, []string{"reply T: There is no /broadcast here."}, nil},
+	}
+	for _, tt := range tests {
+		admins.set("G1", "U1", tt.admin)
+		f.calls = nil
+		dispatchCommand(f, textEvent(inGroup, tt.text), tt.text)
+		calls := f.Calls()
+		if len(calls) != 1 {
+			t.Fatalf("%s: got calls %q", tt.text, calls)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(calls[0], s) {
+				t.Errorf("%s (admin %v): reply lacks %q", tt.text, tt.admin, s)
+			}
+		}
+		for _, s := range tt.absent {
+			if strings.Contains(calls[0], s) {
+				t.Errorf("%s (admin %v): reply has %q", tt.text, tt.admin, s)
+			}
+		}
+	}
+}
+
+func TestHelpCarouselPages(t *testing.T) {
+	var names []string
+	for i := 0; i < helpPerBubble*helpMaxPages+3; i++ {
+		names = append(names, "help")
+	}
+	b, err := json.Marshal(helpCarousel("en", names))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), `"type":"bubble"`); n != helpMaxPages {
+		t.Errorf("got %d bubbles, want %d", n, helpMaxPages)
+	}
+	if !strings.Contains(string(b), "Commands · 12/12") {
+		t.Errorf("last page is not numbered: %s", b)
+	}
+}
@@ -0,0 +1,59 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// texts holds translated texts by key and language. English is the
+// fallback for missing translations.
+var texts = map[string]map[string]string{}
+
+// registerTexts adds the texts of lang, keyed like the English ones.
+func registerTexts(lang string, m map[string]string) {
+	for key, text := range m {
+		if texts[key] == nil {
+			texts[key] = map[string]string{}
+		}
+		texts[key][lang] = text
+	}
+}
+
+// tr formats the text key in lang, or in English if it has no translation.
+func tr(lang, key string, a ...interface{}) string {
+	text, ok := texts[key][lang]
+	if !ok {
+		if text, ok = texts[key]["en"]; !ok {
+			text = key
+		}
+	}
+	return fmt.Sprintf(text, a...)
+}
+
+// languages lists the languages with texts, sorted.
+func languages() []string {
+	seen := map[string]bool{}
+	var langs []string
+	for _, m := range texts {
+		for lang := range m {
+			if !seen[lang] {
+				seen[lang] = true
+				langs = append(langs, lang)
+			}
+		}
+	}
+	sort.Strings(langs)
+	return langs
+}
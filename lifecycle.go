@@ -0,0 +1,201 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// When the bot leaves a group or room, its settings (admins, opt-outs,
+// command toggles, language, tags...) are kept so that a re-join picks them
+// up again. Its content (archive, notes, quotes, statistics...) is deleted
+// once the chat has been gone for leftChatGrace.
+
+const (
+	leftChatSweep = 24 * time.Hour
+	churnWeeks    = 8
+)
+
+// leftChatGrace is how long content of a left chat is kept, from
+// LeftChatGraceDays.
+var leftChatGrace = 30 * 24 * time.Hour
+
+func init() {
+	registerCommand("churn", churnCommand)
+	registerHelp("churn", commandHelp{
+		Summary:   "Count the groups and rooms the bot joined and left each week",
+		SummaryFa: "گزارش ورود و خروج ربات از گروه‌ها در هر هفته",
+		Usage:     []string{"/churn", "/churn 12"},
+		Where:     inAnyChats,
+		Access:    forOperators,
+	})
+}
+
+// chatChange is the bot joining or leaving a group or room.
+type chatChange struct {
+	Time    time.Time `json:"time"`
+	Chat    string    `json:"chat"`
+	Channel string    `json:"channel"`
+	Type    string    `json:"type"`         // join or leave
+	By      string    `json:"by,omitempty"` // user ID or "dashboard"; LINE does not tell who invited or removed the bot
+}
+
+// lifecycle is the history of joins and leaves.
+var lifecycle = &changeLog{}
+
+type changeLog struct {
+	mu      sync.Mutex
+	Changes []chatChange `json:"changes"`
+}
+
+func (l *changeLog) load() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := db.load("lifecycle", l); err != nil {
+		log.Print(err)
+	}
+}
+
+func (l *changeLog) add(c chatChange) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Changes = append(l.Changes, c)
+	if err := db.save("lifecycle", l); err != nil {
+		log.Print(err)
+	}
+}
+
+// of returns the changes of chat id, oldest first.
+func (l *changeLog) of(id string) []chatChange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []chatChange
+	for _, c := range l.Changes {
+		if c.Chat == id {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// since returns the changes after t.
+func (l *changeLog) since(t time.Time) []chatChange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []chatChange
+	for _, c := range l.Changes {
+		if c.Time.After(t) {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// joined records that the bot joined chat id, or came back to it.
+func joined(id, by string) {
+	ch := channelFor(id)
+	if chats.join(ch, id) {
+		log.Printf("Back in %s, with its earlier settings", id)
+	}
+	lifecycle.add(chatChange{Time: time.Now(), Chat: id, Channel: ch.Name, Type: "join", By: by})
+}
+
+// left records that the bot left chat id. LINE sends no leave event when
+// the bot leaves by itself, so /bye and the dashboard call this too.
+func left(id, by string) {
+	chats.leave(id)
+	// Locations are not worth keeping around for a possible return.
+	locations.forgetChat(id)
+	lifecycle.add(chatChange{Time: time.Now(), Chat: id, Channel: channelFor(id).Name, Type: "leave", By: by})
+}
+
+// forgetChat deletes the content kept for chat id, but not its settings.
+func forgetChat(id string) {
+	archives.forgetChat(id)
+	notebook.forgetChat(id)
+	quotes.forgetChat(id)
+	reposts.forgetChat(id)
+	stickerStats.forgetChat(id)
+	members.forgetChat(id)
+	profiles.forgetChat(id)
+	searches.forgetChat(id)
+	digests.forgetChat(id)
+	links.forgetChat(id)
+}
+
+// sweepLeftChats deletes the content of chats left longer than the grace
+// period.
+func sweepLeftChats() {
+	for {
+		for _, c := range chats.gone() {
+			if !c.Purged && time.Since(c.Left) > leftChatGrace {
+				forgetChat(c.ID)
+				chats.purged(c.ID)
+				log.Printf("Deleted the content of %s, left on %s", c.ID, c.Left.Format("2006-01-02"))
+			}
+		}
+		scheduled("Left chat cleanup", time.Now(), time.Now().Add(leftChatSweep))
+		time.Sleep(leftChatSweep)
+	}
+}
+
+// weekOf names the ISO week of t, such as 2024-W07.
+func weekOf(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// churnReport counts the joins and leaves of each of the last weeks.
+func churnReport(weeks int, now time.Time) string {
+	start := now.AddDate(0, 0, -7*(weeks-1))
+	// Go back to the Monday of the first week.
+	start = time.Date(start.Year(), start.Month(), start.Day()-(int(start.Weekday())+6)%7, 0, 0, 0, 0, start.Location())
+	joins, leaves := map[string]int{}, map[string]int{}
+	for _, c := range lifecycle.since(start) {
+		if c.Type == "join" {
+			joins[weekOf(c.Time)]++
+		} else {
+			leaves[weekOf(c.Time)]++
+		}
+	}
+	lines := []string{fmt.Sprintf("In %d groups and rooms now.", len(chats.list()))}
+	for d := start; !d.After(now); d = d.AddDate(0, 0, 7) {
+		w := weekOf(d)
+		lines = append(lines, fmt.Sprintf("%s: +%d −%d", w, joins[w], leaves[w]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// churnCommand reports joins and leaves per week to bot operators:
+// /churn [weeks]
+func churnCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	if !adminIDs[event.Source.UserID] {
+		return textReplyf("Only bot operators can see the churn.")
+	}
+	weeks := churnWeeks
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > 52 {
+			return textReplyf("Usage: /churn [weeks, 1-52]")
+		}
+		weeks = n
+	}
+	return textReplyf("%s", churnReport(weeks, time.Now()))
+}
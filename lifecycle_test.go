@@ -0,0 +1,88 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestJoinLeaveRejoin(t *testing.T) {
+	useFake(t)
+	chats.Chats = map[string]*chatInfo{}
+	lifecycle.Changes = nil
+	defer func() {
+		chats.Chats = map[string]*chatInfo{}
+		lifecycle.Changes = nil
+		notebook.Chats = map[string]*chatNotes{}
+	}()
+	join := &linebot.Event{Type: linebot.EventTypeJoin, ReplyToken: "T", Source: inGroup}
+	leave := &linebot.Event{Type: linebot.EventTypeLeave, Source: inGroup}
+
+	handleEvent(defaultChannel.api, join)
+	chats.setDisabled("G1", []string{"roll"})
+	quotes.add("G1", quote{Text: "hello"})
+	notebook.update("G1", func(c *chatNotes) {
+		c.Rules = "Be kind."
+		c.Notes["wifi"] = &note{Text: "guest / 1234"}
+	})
+	admins.set("G1", "U2", true)
+	handleEvent(defaultChannel.api, leave)
+	if c, _ := chats.get("G1"); c.Left.IsZero() || len(chats.list()) != 0 {
+		t.Fatalf("still in G1 after the leave event: %+v", c)
+	}
+
+	forgetChat("G1")
+	if len(quotes.find("G1", func(quote) bool { return true })) != 0 {
+		t.Error("quotes kept after cleanup")
+	}
+	if names := notebook.names("G1"); len(names) != 0 {
+		t.Errorf("notes %v kept after cleanup", names)
+	}
+
+	handleEvent(defaultChannel.api, join)
+	c, _ := chats.get("G1")
+	if !c.Left.IsZero() || chats.allows("G1", "roll") || len(admins.list("G1")) != 1 || notebook.rules("G1") != "Be kind." {
+		t.Errorf("settings not restored after re-joining: %+v, admins %v, rules %q", c, admins.list("G1"), notebook.rules("G1"))
+	}
+	var types []string
+	for _, change := range lifecycle.of("G1") {
+		types = append(types, change.Type)
+	}
+	if strings.Join(types, " ") != "join leave join" {
+		t.Errorf("history %v", types)
+	}
+	admins.set("G1", "U2", false)
+}
+
+func TestChurnReport(t *testing.T) {
+	chats.Chats = map[string]*chatInfo{"G1": {ID: "G1"}}
+	now := time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC) // Wednesday of 2024-W11
+	lifecycle.Changes = []chatChange{
+		{Time: now.AddDate(0, 0, -30), Type: "join"}, // too old
+		{Time: now.AddDate(0, 0, -8), Type: "join"},
+		{Time: now.AddDate(0, 0, -7), Type: "leave"},
+		{Time: now.AddDate(0, 0, -1), Type: "join"},
+	}
+	defer func() {
+		chats.Chats = map[string]*chatInfo{}
+		lifecycle.Changes = nil
+	}()
+	want := "In 1 groups and rooms now.\n2024-W10: +1 −1\n2024-W11: +1 −0"
+	if got := churnReport(2, now); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,477 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	linkLogSize   = 500 // links kept per chat
+	linkListed    = 10
+	titleTimeout  = 5 * time.Second
+	titlePageSize = 256 << 10
+	titleLength   = 100
+)
+
+// blockedDomains are domains warned about in every chat, from the
+// BlockedDomains setting.
+var blockedDomains []string
+
+func init() {
+	registerCommand("links", linksCommand)
+	registerHelp("links", commandHelp{
+		Summary:    "List the links posted here, by day, week or a search term",
+		SummaryFa:  "فهرست پیوندهای فرستاده‌شده در گروه، بر اساس روز، هفته یا عبارت جستجو",
+		Usage:      []string{"/links", "/links today", "/links week", "/links recipe"},
+		AdminUsage: []string{"/links on", "/links off", "/links block example.com", "/links unblock example.com"},
+		Where:      inShared,
+	})
+	registerMessageHook(linkHook)
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// extractURLs finds the web addresses in text, without punctuation that
+// ends the sentence around them.
+func extractURLs(text string) []string {
+	var urls []string
+	for _, u := range urlPattern.FindAllString(text, -1) {
+		if u = strings.TrimRight(u, ".,;:!?)]}'»،؛؟"); !strings.HasSuffix(u, "://") {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// linkDomain is the host of u in lower case and without "www.", or "" if u
+// is no URL.
+func linkDomain(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// parseDomains reads a list of domains separated by commas or spaces.
+func parseDomains(spec string) []string {
+	var domains []string
+	for _, d := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ' ' }) {
+		domains = append(domains, strings.TrimPrefix(strings.ToLower(d), "www."))
+	}
+	return domains
+}
+
+// blockedBy tells which of domains the domain d is, or is under.
+func blockedBy(d string, domains []string) string {
+	for _, blocked := range domains {
+		if d == blocked || strings.HasSuffix(d, "."+blocked) {
+			return blocked
+		}
+	}
+	return ""
+}
+
+// postedLink is a link sent to a chat.
+type postedLink struct {
+	URL       string    `json:"url"`
+	UserID    string    `json:"userId"`
+	Time      time.Time `json:"time"`
+	MessageID string    `json:"messageId"`
+	Title     string    `json:"title,omitempty"`
+}
+
+// chatLinks is the link log of a group or room. Links are only kept once
+// an admin turns the log on, but blocked domains are warned about anyway.
+type chatLinks struct {
+	Enabled bool         `json:"enabled"`
+	Blocked []string     `json:"blocked,omitempty"`
+	Links   []postedLink `json:"links,omitempty"`
+}
+
+// links holds the link log of every group and room.
+var links = &linkLog{Chats: map[string]*chatLinks{}}
+
+type linkLog struct {
+	mu    sync.Mutex
+	Chats map[string]*chatLinks `json:"chats"`
+}
+
+func (l *linkLog) load() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := db.load("links", l); err != nil {
+		log.Print(err)
+	}
+}
+
+// save writes the log out. l.mu must be held.
+func (l *linkLog) save() {
+	if err := db.save("links", l); err != nil {
+		log.Print(err)
+	}
+}
+
+func (l *linkLog) chat(id string) *chatLinks {
+	c := l.Chats[id]
+	if c == nil {
+		c = &chatLinks{}
+		l.Chats[id] = c
+	}
+	return c
+}
+
+func (l *linkLog) settings(id string) (enabled bool, blocked []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.Chats[id]
+	if c == nil {
+		return false, nil
+	}
+	return c.Enabled, append([]string(nil), c.Blocked...)
+}
+
+// update changes the log of chat id with fn and saves it.
+func (l *linkLog) update(id string, fn func(c *chatLinks)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fn(l.chat(id))
+	l.save()
+}
+
+// add logs links posted to chat id, if its log is on, and tells whether
+// they were kept.
+func (l *linkLog) add(id string, posted []postedLink) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.Chats[id]
+	if c == nil || !c.Enabled {
+		return false
+	}
+	c.Links = append(c.Links, posted...)
+	if len(c.Links) > linkLogSize {
+		c.Links = c.Links[len(c.Links)-linkLogSize:]
+	}
+	l.save()
+	return true
+}
+
+// titled sets the title of the link u posted in message messageID.
+func (l *linkLog) titled(id, messageID, u, title string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.Chats[id]
+	if c == nil {
+		return
+	}
+	for i := range c.Links {
+		if link := &c.Links[i]; link.MessageID == messageID && link.URL == u {
+			link.Title = title
+			l.save()
+			return
+		}
+	}
+}
+
+// find returns the links of chat id posted since the given time whose
+// address or title has all of terms, the latest first.
+func (l *linkLog) find(id string, since time.Time, terms []string, n int) []postedLink {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.Chats[id]
+	if c == nil {
+		return nil
+	}
+	var found []postedLink
+	for i := len(c.Links) - 1; i >= 0 && len(found) < n; i-- {
+		link := c.Links[i]
+		if link.Time.Before(since) {
+			break
+		}
+		text := foldLink(link.URL + " " + link.Title)
+		matches := true
+		for _, term := range terms {
+			if !strings.Contains(text, foldLink(term)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, link)
+		}
+	}
+	return found
+}
+
+// foldLink prepares text for matching, like search does for words.
+func foldLink(text string) string {
+	return strings.Map(searchFold, strings.ToLower(text))
+}
+
+// forgetChat empties the log of chat id, keeping its settings.
+func (l *linkLog) forgetChat(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c := l.Chats[id]; c != nil && len(c.Links) > 0 {
+		c.Links = nil
+		l.save()
+	}
+}
+
+// titleFetcher looks up the title of a web page.
+type titleFetcher interface {
+	Title(u string) (string, error)
+}
+
+// titles fetches the titles of logged links, if set with LinkTitles.
+var titles titleFetcher
+
+// httpTitles reads titles from the pages themselves.
+type httpTitles struct {
+	client *http.Client
+}
+
+var (
+	errNotHTML       = errors.New("not an HTML page")
+	errPrivateTarget = errors.New("refusing to fetch from a private address")
+)
+
+// privateNets are the private ranges of RFC 1918 and RFC 4193, and the
+// carrier-grade NAT range shared by the provider's customers.
+var privateNets = parseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// publicIP reports whether ip can be reached from the internet.
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newHTTPTitles returns an httpTitles that only fetches from public
+// addresses, so links cannot make the chatbot reach into its own network.
+func newHTTPTitles() httpTitles {
+	dialer := &net.Dialer{
+		Timeout: titleTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return errPrivateTarget
+			}
+			return nil
+		},
+	}
+	return httpTitles{client: &http.Client{
+		Timeout:   titleTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, Proxy: http.ProxyFromEnvironment},
+	}}
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+func (t httpTitles) Title(u string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "text/html")
+	res, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s", u, res.Status)
+	}
+	if !strings.Contains(res.Header.Get("Content-Type"), "html") {
+		return "", errNotHTML
+	}
+	page, err := io.ReadAll(io.LimitReader(res.Body, titlePageSize))
+	if err != nil {
+		return "", err
+	}
+	m := titlePattern.FindSubmatch(page)
+	if m == nil {
+		return "", nil
+	}
+	title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	return truncate(title, titleLength), nil
+}
+
+// fetchTitles looks up the titles of links posted in chat id.
+func fetchTitles(id string, posted []postedLink) {
+	for _, link := range posted {
+		title, err := titles.Title(link.URL)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		if title != "" {
+			links.titled(id, link.MessageID, link.URL, title)
+		}
+	}
+}
+
+// linkHook logs the links posted in groups and rooms, and warns about the
+// ones to blocked domains.
+func linkHook(api botAPI, event *linebot.Event) {
+	m, ok := event.Message.(*linebot.TextMessage)
+	if !ok || event.Source.Type == linebot.EventSourceTypeUser || strings.HasPrefix(m.Text, "/") {
+		return
+	}
+	urls := extractURLs(m.Text)
+	if len(urls) == 0 {
+		return
+	}
+	id := sourceID(event.Source)
+	_, blocked := links.settings(id)
+	blocked = append(blocked, blockedDomains...)
+	var posted []postedLink
+	var warned []string
+	for _, u := range urls {
+		posted = append(posted, postedLink{URL: u, UserID: event.Source.UserID, Time: event.Timestamp, MessageID: m.ID})
+		if d := blockedBy(linkDomain(u), blocked); d != "" && !hasString(warned, d) {
+			warned = append(warned, d)
+		}
+	}
+	if links.add(id, posted) && titles != nil {
+		go fetchTitles(id, posted)
+	}
+	if len(warned) > 0 {
+		// The reply token belongs to commands and notes.
+		pushMessage(id, linebot.NewTextMessage(fmt.Sprintf("⚠️ Careful: links to %s are blocked here. Better not to open them.", strings.Join(warned, ", "))))
+	}
+}
+
+// startOfDay is midnight before t, in server local time.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func linksCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	if event.Source.GroupID == "" && event.Source.RoomID == "" {
+		return textReplyf("/links only works in a group or room.")
+	}
+	id := sourceID(event.Source)
+	enabled, blocked := links.settings(id)
+	sub := ""
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	switch sub {
+	case "on", "off", "block", "unblock":
+		if !isAdmin(event.Source) {
+			return textReplyf("Only admins can change the link log.")
+		}
+	}
+	switch sub {
+	case "on":
+		links.update(id, func(c *chatLinks) { c.Enabled = true })
+		return textReplyf("🔗 Notice: from now on I keep the links posted here, with who posted them and when, until an admin types /links off. /links lists them.")
+	case "off":
+		links.update(id, func(c *chatLinks) { c.Enabled, c.Links = false, nil })
+		return textReplyf("🔗 The link log is off and the links kept are deleted.")
+	case "block", "unblock":
+		if len(args) != 2 || linkDomain("https://"+args[1]) == "" {
+			return textReplyf("Usage: /links %s example.com", sub)
+		}
+		d := linkDomain("https://" + args[1])
+		links.update(id, func(c *chatLinks) {
+			var kept []string
+			for _, b := range c.Blocked {
+				if b != d {
+					kept = append(kept, b)
+				}
+			}
+			if sub == "block" {
+				kept = append(kept, d)
+			}
+			c.Blocked = kept
+		})
+		if sub == "block" {
+			return textReplyf("⚠️ I'll warn about links to %s.", d)
+		}
+		return textReplyf("Links to %s are fine again.", d)
+	}
+	if !enabled {
+		reply := "🔗 The link log is off. Admins can turn it on with /links on."
+		if all := append(blocked, blockedDomains...); len(all) > 0 {
+			reply += "\nBlocked: " + strings.Join(all, ", ")
+		}
+		return textReplyf("%s", reply)
+	}
+
+	var since time.Time
+	var terms []string
+	heading := "Latest links"
+	switch sub {
+	case "":
+	case "today":
+		since, heading = startOfDay(time.Now()), "Links today"
+	case "week":
+		since, heading = startOfDay(time.Now()).AddDate(0, 0, -6), "Links this week"
+	default:
+		terms, heading = args, "Links with “"+strings.Join(args, " ")+"”"
+	}
+	found := links.find(id, since, terms, linkListed)
+	if len(found) == 0 {
+		return textReplyf("🔗 No links found.")
+	}
+	var lines []string
+	for _, link := range found {
+		entry := link.URL
+		if link.Title != "" {
+			entry = link.Title + "\n" + link.URL
+		}
+		lines = append(lines, fmt.Sprintf("%s\n%s · %s", entry, displayName(event.Source, link.UserID), link.Time.Format("2006-01-02 15:04")))
+	}
+	return textReplyf("🔗 %s:\n\n%s", heading, strings.Join(lines, "\n\n"))
+}
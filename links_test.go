@@ -0,0 +1,212 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"see https://example.com/a?b=1.", []string{"https://example.com/a?b=1"}},
+		{"(http://x.org) and https://y.net/p, ok", []string{"http://x.org", "https://y.net/p"}},
+		{"این را ببینید: https://example.ir/خبر؟", []string{"https://example.ir/خبر"}},
+		{"no links, just https://", nil},
+	}
+	for _, tt := range tests {
+		if got := extractURLs(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("extractURLs(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBlockedBy(t *testing.T) {
+	blocked := parseDomains("Bad.example, www.scam.net")
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://bad.example/x", "bad.example"},
+		{"http://WWW.bad.example", "bad.example"},
+		{"https://login.scam.net/a", "scam.net"},
+		{"https://notbad.example", ""},
+		{"https://scam.network", ""},
+	}
+	for _, tt := range tests {
+		if got := blockedBy(linkDomain(tt.url), blocked); got != tt.want {
+			t.Errorf("blockedBy(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1::1", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"172.32.0.1", true},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd12:3456::1", false},
+		{"fe80::1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+// fakeTitles has the titles of a few pages.
+type fakeTitles map[string]string
+
+func (f fakeTitles) Title(u string) (string, error) {
+	if title, ok := f[u]; ok {
+		return title, nil
+	}
+	return "", errors.New("no such page")
+}
+
+func TestLinks(t *testing.T) {
+	f := useFake(t)
+	f.profiles["U2"] = &linebot.UserProfileResponse{UserID: "U2", DisplayName: "Bob"}
+	links.Chats = map[string]*chatLinks{}
+	blockedDomains = []string{"scam.net"}
+	defer func() {
+		links.Chats = map[string]*chatLinks{}
+		blockedDomains = nil
+		admins.set("G1", "U1", false)
+	}()
+	bob := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: "U2"}
+	say := func(src *linebot.EventSource, id, text string, days int) []string {
+		f.calls = nil
+		event := textEvent(src, text)
+		event.Message.(*linebot.TextMessage).ID = id
+		event.Timestamp = time.Now().AddDate(0, 0, -days)
+		handleEvent(f, event)
+		return f.Calls()
+	}
+	run := func(text string, want string) {
+		t.Helper()
+		calls := say(inGroup, "", text, 0)
+		if len(calls) == 0 || !strings.Contains(calls[len(calls)-1], want) {
+			t.Errorf("%s: got %q, want a reply with %q", text, calls, want)
+		}
+	}
+
+	say(bob, "M0", "before the log https://example.com/early", 0)
+	run("/links", "The link log is off")
+	run("/links on", "Only admins")
+	if c, ok := links.Chats["G1"]; ok {
+		t.Errorf("links and /links made an entry before the log was on: %+v", c)
+	}
+	admins.set("G1", "U1", true)
+	run("/links on", "Notice: from now on I keep the links")
+	say(bob, "M1", "recipe: https://food.example/pasta", 10)
+	say(inGroup, "M2", "map https://maps.example/lake and https://food.example/cake!", 3)
+	say(bob, "M3", "news https://news.example/today", 0)
+	checkCalls(t, say(bob, "M4", "win a prize https://login.scam.net/x", 0), []string{
+		"push G1: ⚠️ Careful: links to scam.net are blocked here. Better not to open them.",
+	})
+	run("/links block Maps.Example", "I'll warn about links to maps.example")
+	if calls := say(inGroup, "M5", "again https://maps.example/lake", 0); len(calls) == 0 || !strings.Contains(calls[len(calls)-1], "maps.example") {
+		t.Errorf("no warning for a blocked domain: %q", calls)
+	}
+	run("/links unblock maps.example", "fine again")
+
+	titles = fakeTitles{"https://food.example/pasta": "Pasta al forno"}
+	fetchTitles("G1", []postedLink{{URL: "https://food.example/pasta", MessageID: "M1"}, {URL: "https://gone.example", MessageID: "M1"}})
+	titles = nil
+
+	run("/links", "Latest links:\n\nhttps://maps.example/lake\nAlice")
+	run("/links today", "Links today:\n\nhttps://maps.example/lake")
+	run("/links week", "https://food.example/cake\nAlice · "+time.Now().AddDate(0, 0, -3).Format("2006-01-02"))
+	run("/links pasta", "Links with “pasta”:\n\nPasta al forno\nhttps://food.example/pasta\nBob")
+	run("/links FOREST", "No links found.")
+	f.calls = nil
+	handleEvent(f, textEvent(inGroup, "/links today"))
+	if calls := f.Calls(); strings.Contains(calls[len(calls)-1], "cake") {
+		t.Errorf("/links today lists older links: %q", calls)
+	}
+	run("/links off", "deleted")
+	run("/links", "Blocked: scam.net")
+	if c := links.Chats["G1"]; len(c.Links) != 0 {
+		t.Errorf("%d links kept after /links off", len(c.Links))
+	}
+}
+
+func TestHTTPTitles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><head><TITLE>\n  Fish &amp; Chips\n</TITLE></head></html>")
+		case "/untitled":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<p>hi</p>")
+		case "/data":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, "{}")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	fetcher := httpTitles{client: server.Client()}
+	tests := []struct {
+		path    string
+		want    string
+		failing bool
+	}{
+		{"/page", "Fish & Chips", false},
+		{"/untitled", "", false},
+		{"/data", "", true},
+		{"/missing", "", true},
+	}
+	for _, tt := range tests {
+		got, err := fetcher.Title(server.URL + tt.path)
+		if got != tt.want || (err != nil) != tt.failing {
+			t.Errorf("%s: got %q, %v", tt.path, got, err)
+		}
+	}
+
+	// The real fetcher keeps off private addresses such as this one.
+	if _, err := newHTTPTitles().Title(server.URL + "/page"); !errors.Is(err, errPrivateTarget) {
+		t.Errorf("fetched from %s: %v", server.URL, err)
+	}
+}
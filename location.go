@@ -0,0 +1,331 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	locationHours    = 24
+	maxLocationHours = 24 * 7
+	earthRadiusKm    = 6371.0
+	locationSweep    = 10 * time.Minute
+)
+
+func init() {
+	registerCommand("location", locationCommand)
+	registerCommand("meet", meetCommand)
+	registerCommand("distance", distanceCommand)
+	registerHelp("location", commandHelp{
+		Summary:   "Share your location for /meet and /distance",
+		SummaryFa: "اشتراک موقعیت مکانی برای /meet و /distance",
+		Usage:     []string{"/location on", "/location on 3", "/location off"},
+		Where:     inShared,
+	})
+	registerHelp("meet", commandHelp{
+		Summary:   "Find the place to meet with the least travel in all",
+		SummaryFa: "پیدا کردن محلی برای دیدار با کمترین مسافت در مجموع",
+		Usage:     []string{"/meet"},
+		Where:     inShared,
+	})
+	registerHelp("distance", commandHelp{
+		Summary:   "Show how far apart members who shared their location are",
+		SummaryFa: "فاصله‌ی اعضایی که موقعیت خود را به اشتراک گذاشته‌اند",
+		Usage:     []string{"/distance"},
+		Where:     inShared,
+	})
+	registerMessageHook(rememberLocation)
+	shareLocation := func(event *linebot.Event, args []string) []linebot.QuickReplyAction {
+		if len(args) > 0 && strings.EqualFold(args[0], "off") {
+			return nil
+		}
+		return []linebot.QuickReplyAction{linebot.NewLocationAction("📍 Share location")}
+	}
+	registerSuggestions("location", shareLocation)
+	registerSuggestions("meet", shareLocation)
+	registerSuggestions("distance", shareLocation)
+}
+
+// sharedLocation is a member's consent to keep their location, and the last
+// location they shared while it lasts.
+type sharedLocation struct {
+	Until     time.Time `json:"until"`
+	Shared    bool      `json:"shared"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+}
+
+// locations holds, per group or room, the members who agreed to have their
+// location remembered. Everything is forgotten when the consent expires.
+var locations = &locationBook{Chats: map[string]map[string]*sharedLocation{}}
+
+type locationBook struct {
+	mu    sync.Mutex
+	Chats map[string]map[string]*sharedLocation `json:"chats"`
+}
+
+func (l *locationBook) load() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := db.load("locations", l); err != nil {
+		log.Print(err)
+	}
+}
+
+func (l *locationBook) save() {
+	if err := db.save("locations", l); err != nil {
+		log.Print(err)
+	}
+}
+
+// consent starts keeping the locations of userID in chat id until until,
+// or forgets them when until is zero.
+func (l *locationBook) consent(id, userID string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.IsZero() {
+		delete(l.Chats[id], userID)
+	} else {
+		if l.Chats[id] == nil {
+			l.Chats[id] = map[string]*sharedLocation{}
+		}
+		if l.Chats[id][userID] == nil {
+			l.Chats[id][userID] = &sharedLocation{}
+		}
+		l.Chats[id][userID].Until = until
+	}
+	l.save()
+}
+
+// forgetChat drops every location and consent of chat id.
+func (l *locationBook) forgetChat(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.Chats[id]; !ok {
+		return
+	}
+	delete(l.Chats, id)
+	l.save()
+}
+
+// set records a shared location if its member consented.
+func (l *locationBook) set(id, userID string, lat, lon float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	loc := l.Chats[id][userID]
+	if loc == nil || time.Now().After(loc.Until) {
+		return false
+	}
+	loc.Shared, loc.Latitude, loc.Longitude = true, lat, lon
+	l.save()
+	return true
+}
+
+// expire forgets the consents and locations that ran out at now.
+func (l *locationBook) expire(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expired := false
+	for id, chat := range l.Chats {
+		for userID, loc := range chat {
+			if now.After(loc.Until) {
+				delete(chat, userID)
+				expired = true
+			}
+		}
+		if len(chat) == 0 {
+			delete(l.Chats, id)
+		}
+	}
+	if expired {
+		l.save()
+	}
+}
+
+// sweepLocations forgets expired locations periodically, so that they are
+// not kept when nobody asks for them.
+func sweepLocations() {
+	for {
+		locations.expire(time.Now())
+		scheduled("Location expiry", time.Now(), time.Now().Add(locationSweep))
+		time.Sleep(locationSweep)
+	}
+}
+
+// current returns the unexpired locations of chat id by user, dropping the
+// expired ones.
+func (l *locationBook) current(id string) map[string]sharedLocation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	found := map[string]sharedLocation{}
+	expired := false
+	for userID, loc := range l.Chats[id] {
+		if time.Now().After(loc.Until) {
+			delete(l.Chats[id], userID)
+			expired = true
+			continue
+		}
+		if loc.Shared {
+			found[userID] = *loc
+		}
+	}
+	if expired {
+		l.save()
+	}
+	return found
+}
+
+func rememberLocation(api botAPI, event *linebot.Event) {
+	m, ok := event.Message.(*linebot.LocationMessage)
+	if !ok {
+		return
+	}
+	locations.set(sourceID(event.Source), event.Source.UserID, m.Latitude, m.Longitude)
+}
+
+func locationCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	id, userID := sourceID(event.Source), event.Source.UserID
+	sub := ""
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	switch sub {
+	case "on":
+		hours := locationHours
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 || n > maxLocationHours {
+				return textReplyf("Hours must be 1-%d.", maxLocationHours)
+			}
+			hours = n
+		}
+		locations.consent(id, userID, time.Now().Add(time.Duration(hours)*time.Hour))
+		return textReplyf("📍 For the next %d hours I will remember the last location you share here, for /meet and /distance. /location off forgets it.", hours)
+	case "off":
+		locations.consent(id, userID, time.Time{})
+		return textReplyf("📍 Your location here has been forgotten.")
+	}
+	return textReplyf("Usage: /location on [hours], /location off")
+}
+
+type point struct {
+	lat, lon float64
+}
+
+// haversine is the great-circle distance between a and b in kilometres.
+func haversine(a, b point) float64 {
+	rad := math.Pi / 180
+	dLat := (b.lat - a.lat) * rad
+	dLon := (b.lon - a.lon) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(a.lat*rad)*math.Cos(b.lat*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func toVector(p point) [3]float64 {
+	rad := math.Pi / 180
+	lat, lon := p.lat*rad, p.lon*rad
+	return [3]float64{math.Cos(lat) * math.Cos(lon), math.Cos(lat) * math.Sin(lon), math.Sin(lat)}
+}
+
+func toPoint(v [3]float64) point {
+	deg := 180 / math.Pi
+	return point{math.Atan2(v[2], math.Hypot(v[0], v[1])) * deg, math.Atan2(v[1], v[0]) * deg}
+}
+
+// meetingPoint is the point with the least total travel distance to all
+// points, found with Weiszfeld's iteration on the sphere starting from the
+// centroid.
+func meetingPoint(points []point) point {
+	weighted := func(weight func(point) float64) point {
+		var sum [3]float64
+		for _, p := range points {
+			v, w := toVector(p), weight(p)
+			for i := range sum {
+				sum[i] += w * v[i]
+			}
+		}
+		return toPoint(sum)
+	}
+	m := weighted(func(point) float64 { return 1 })
+	for i := 0; i < 100; i++ {
+		next := weighted(func(p point) float64 {
+			return 1 / math.Max(haversine(m, p), 0.001)
+		})
+		if haversine(m, next) < 0.001 {
+			return next
+		}
+		m = next
+	}
+	return m
+}
+
+func meetCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	found := locations.current(sourceID(event.Source))
+	if len(found) < 2 {
+		return textReplyf("At least two members need to share their location. Type /location on, then share your location.")
+	}
+	var points []point
+	for _, loc := range found {
+		points = append(points, point{loc.Latitude, loc.Longitude})
+	}
+	m := meetingPoint(points)
+	var b strings.Builder
+	for _, userID := range sortedKeys(found) {
+		loc := found[userID]
+		fmt.Fprintf(&b, "%s: %.1f km\n", displayName(event.Source, userID), haversine(m, point{loc.Latitude, loc.Longitude}))
+	}
+	return []linebot.SendingMessage{
+		linebot.NewLocationMessage("Meeting point", fmt.Sprintf("%.5f, %.5f", m.lat, m.lon), m.lat, m.lon),
+		linebot.NewTextMessage("🤝 Closest overall meeting point for " + strconv.Itoa(len(points)) + " members\n" + strings.TrimSuffix(b.String(), "\n")),
+	}
+}
+
+func distanceCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	found := locations.current(sourceID(event.Source))
+	if len(found) < 2 {
+		return textReplyf("At least two members need to share their location. Type /location on, then share your location.")
+	}
+	userIDs := sortedKeys(found)
+	names := map[string]string{}
+	for _, userID := range userIDs {
+		names[userID] = displayName(event.Source, userID)
+	}
+	var b strings.Builder
+	b.WriteString("📏 Distances\n")
+	for i, a := range userIDs {
+		for _, c := range userIDs[i+1:] {
+			la, lc := found[a], found[c]
+			fmt.Fprintf(&b, "%s ↔ %s: %.1f km\n", names[a], names[c], haversine(point{la.Latitude, la.Longitude}, point{lc.Latitude, lc.Longitude}))
+		}
+	}
+	return textReplyf("%s", strings.TrimSuffix(b.String(), "\n"))
+}
+
+func sortedKeys(m map[string]sharedLocation) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
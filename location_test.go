@@ -0,0 +1,123 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestLocationConsent(t *testing.T) {
+	locations.Chats = map[string]map[string]*sharedLocation{}
+	defer func() { locations.Chats = map[string]map[string]*sharedLocation{} }()
+	now := time.Now()
+
+	if locations.set("G1", "U1", 35.7, 51.4) {
+		t.Error("a location was kept without consent")
+	}
+	locations.consent("G1", "U1", now.Add(time.Hour))
+	locations.consent("G1", "U2", now.Add(-time.Minute))
+	if !locations.set("G1", "U1", 35.7, 51.4) || locations.set("G1", "U2", 35.8, 51.5) {
+		t.Error("locations were kept against the consents")
+	}
+	if found := locations.current("G1"); len(found) != 1 || found["U1"].Latitude != 35.7 {
+		t.Errorf("current locations %v", found)
+	}
+
+	// The sweep forgets what ran out even if nobody asks again.
+	locations.consent("G2", "U3", now.Add(time.Hour))
+	locations.set("G2", "U3", 1, 2)
+	locations.expire(now.Add(2 * time.Hour))
+	var stored locationBook
+	if err := db.load("locations", &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(locations.Chats) != 0 || len(stored.Chats) != 0 {
+		t.Errorf("expired locations are kept: %v, stored %v", locations.Chats, stored.Chats)
+	}
+
+	locations.consent("G1", "U1", now.Add(time.Hour))
+	locations.consent("G1", "U1", time.Time{})
+	if len(locations.Chats["G1"]) != 0 {
+		t.Error("/location off did not forget the consent")
+	}
+}
+
+func TestMeetingPoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []point
+		want   point
+	}{
+		{"two points", []point{{0, 0}, {0, 2}}, point{0, 1}},
+		{"a far one does not pull", []point{{0, 0}, {0, 1}, {0, 10}}, point{0, 1}},
+		{"one in each corner", []point{{-1, -1}, {-1, 1}, {1, -1}, {1, 1}}, point{0, 0}},
+	}
+	for _, tt := range tests {
+		got := meetingPoint(tt.points)
+		if d := haversine(got, tt.want); d > 1 {
+			t.Errorf("%s: meeting point %v is %.1f km from %v", tt.name, got, d, tt.want)
+		}
+	}
+	// One degree along the equator.
+	if d := haversine(point{0, 0}, point{0, 1}); math.Abs(d-111.19) > 0.01 {
+		t.Errorf("haversine = %.2f km", d)
+	}
+}
+
+func TestMeetAndDistance(t *testing.T) {
+	f := useFake(t)
+	f.profiles["U2"] = &linebot.UserProfileResponse{UserID: "U2", DisplayName: "Bob"}
+	locations.Chats = map[string]map[string]*sharedLocation{}
+	defer func() { locations.Chats = map[string]map[string]*sharedLocation{} }()
+	bob := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: "U2"}
+	run := func(src *linebot.EventSource, text string) string {
+		t.Helper()
+		f.calls = nil
+		handleEvent(f, textEvent(src, text))
+		calls := f.Calls()
+		if len(calls) == 0 {
+			t.Fatalf("%s: no reply", text)
+		}
+		return calls[len(calls)-1]
+	}
+	share := func(src *linebot.EventSource, lat, lon float64) {
+		handleEvent(f, &linebot.Event{Type: linebot.EventTypeMessage, Source: src, Message: &linebot.LocationMessage{Latitude: lat, Longitude: lon}})
+	}
+
+	if got := run(inGroup, "/distance"); !strings.Contains(got, "At least two members") {
+		t.Errorf("/distance alone: %q", got)
+	}
+	run(inGroup, "/location on")
+	run(bob, "/location on 3")
+	share(inGroup, 0, 0)
+	share(bob, 0, 1)
+	if got := run(inGroup, "/distance"); !strings.Contains(got, "📏 Distances\nAlice ↔ Bob: 111.2 km") {
+		t.Errorf("/distance: %q", got)
+	}
+	got := run(inGroup, "/meet")
+	for _, want := range []string{"Closest overall meeting point for 2 members", "Alice: 55.6 km", "Bob: 55.6 km"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("/meet: %q does not contain %q", got, want)
+		}
+	}
+
+	run(bob, "/location off")
+	if got := run(inGroup, "/meet"); !strings.Contains(got, "At least two members") {
+		t.Errorf("/meet after Bob stopped sharing: %q", got)
+	}
+}
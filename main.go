@@ -17,7 +17,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/line/line-bot-sdk-go/v7/linebot"
 )
@@ -25,17 +27,110 @@ import (
 var bot *linebot.Client
 
 func main() {
-	var err error
-	bot, err = linebot.New(os.Getenv("ChannelSecret"), os.Getenv("ChannelAccessToken"))
+	if err := setAPIRates(os.Getenv("APIRateLimits")); err != nil {
+		log.Print(err)
+	}
+	err := loadChannels(os.Getenv("Channels"))
 	log.Println("Bot:", bot, " err:", err)
+	if dir := os.Getenv("DataDir"); dir != "" {
+		db = newStore(dir)
+	}
+	if path := os.Getenv("QuizBank"); path != "" {
+		quizBankPath = path
+	}
+	for _, userID := range strings.Split(os.Getenv("AdminUserIDs"), ",") {
+		if userID = strings.TrimSpace(userID); userID != "" {
+			adminIDs[userID] = true
+		}
+	}
+	publicURL = os.Getenv("PublicURL")
+	adminToken = os.Getenv("AdminToken")
+	if rate, err := strconv.ParseFloat(os.Getenv("BroadcastRate"), 64); err == nil && rate > 0 {
+		broadcastInterval = time.Duration(float64(time.Second) / rate)
+	}
+	if days, err := strconv.Atoi(os.Getenv("LeftChatGraceDays")); err == nil && days >= 0 {
+		leftChatGrace = time.Duration(days) * 24 * time.Hour
+	}
+	if days, err := strconv.Atoi(os.Getenv("SearchRetentionDays")); err == nil && days >= 0 {
+		searchKeepDays = days
+	}
+	blockedDomains = parseDomains(os.Getenv("BlockedDomains"))
+	if os.Getenv("LinkTitles") == "on" {
+		titles = newHTTPTitles()
+	}
+	if err == nil {
+		err = issueTokens()
+	}
+	if len(os.Args) > 1 {
+		exitOnError(err)
+		if name := os.Getenv("Channel"); name != "" {
+			exitOnError(selectChannel(name))
+		}
+		exitOnError(commandLine(os.Args[1:]))
+		return
+	}
+	if err != nil {
+		// Rotating channels keep trying to get a token in renewTokens.
+		log.Print(err)
+	}
+	chatChannels.load()
+	loadContentKey()
+	chats.load()
+	members.load()
+	profiles.load()
+	searches.load()
+	digests.load()
+	links.load()
+	admins.load()
+	optOuts.load()
+	quotes.load()
+	notebook.load()
+	archives.load()
+	reposts.load()
+	stickerStats.load()
+	locations.load()
+	broadcasts.load()
+	lifecycle.load()
+	users.load()
 	http.HandleFunc("/callback", callbackHandler)
+	http.HandleFunc("/callback/", callbackHandler)
+	http.HandleFunc("/content/", contentHandler)
+	http.HandleFunc("/admin", requireAdmin(dashboardHandler))
+	http.HandleFunc("/admin/chat", requireAdmin(chatPageHandler))
+	http.HandleFunc("/admin/chat/features", requireAdmin(postOnly(chatFeaturesHandler)))
+	http.HandleFunc("/admin/chat/profile", requireAdmin(postOnly(chatProfileHandler)))
+	http.HandleFunc("/admin/chat/push", requireAdmin(postOnly(chatPushHandler)))
+	http.HandleFunc("/admin/chat/leave", requireAdmin(postOnly(chatLeaveHandler)))
+	http.HandleFunc("/admin/broadcast", requireAdmin(broadcastPageHandler))
+	http.HandleFunc("/admin/broadcast/send", requireAdmin(postOnly(broadcastSendHandler)))
+	http.HandleFunc("/admin/archive", requireAdmin(archiveAdminHandler))
+	http.HandleFunc("/admin/archive/file", requireAdmin(archiveFileHandler))
+	if os.Getenv("VerifyWebhook") == "true" {
+		go verifyWebhook()
+	}
+	for _, c := range channels {
+		if c.rotates() {
+			go renewTokens(c)
+		}
+	}
+	go sweepArchives()
+	go sweepSearch()
+	go sweepLocations()
+	go sendDigests()
+	go weeklyStickerSummaries()
+	go sweepLeftChats()
 	port := os.Getenv("PORT")
 	addr := fmt.Sprintf(":%s", port)
 	http.ListenAndServe(addr, nil)
 }
 
 func callbackHandler(w http.ResponseWriter, r *http.Request) {
-	events, err := bot.ParseRequest(r)
+	ch := channelByPath(r.URL.Path)
+	if ch == nil {
+		http.NotFound(w, r)
+		return
+	}
+	events, err := ch.client.ParseRequest(r)
 
 	if err != nil {
 		if err == linebot.ErrInvalidSignature {
@@ -47,108 +142,173 @@ func callbackHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, event := range events {
-		switch event.Type {
-		case linebot.EventTypeUnsend:
-			log.Println("Unsend")
-			target := ""
-			if event.Source.GroupID != "" {
-				target = event.Source.GroupID
-				if profile, err := bot.GetGroupMemberProfile(event.Source.GroupID, event.Source.UserID).Do(); err == nil {
-					if _, err = bot.PushMessage(target, linebot.NewTextMessage(profile.DisplayName+"Don't be shy to recall messages, برای نمایش پروفایل ، me را تایپ کنید!")).Do(); err != nil {
-						log.Print(err)
-					}
-				}
-			} else {
-				target = event.Source.RoomID
-				if profile, err := bot.GetRoomMemberProfile(event.Source.RoomID, event.Source.UserID).Do(); err == nil {
-					if _, err = bot.PushMessage(target, linebot.NewTextMessage(profile.DisplayName+" برای نمایش اطلاعات ، /me را تایپ کنید!")).Do(); err != nil {
-						log.Print(err)
-					}
+		chatChannels.bind(ch, event.Source)
+		chats.seen(ch, event.Source)
+		recentEvents.add(ch, event)
+		handleEvent(ch.api, event)
+	}
+}
+
+// handleEvent answers one webhook event through api.
+func handleEvent(api botAPI, event *linebot.Event) {
+	var err error
+	switch event.Type {
+	case linebot.EventTypeUnsend:
+		log.Println("Unsend")
+		if event.Unsend != nil {
+			searches.unsend(sourceID(event.Source), event.Unsend.MessageID)
+		}
+		target := ""
+		if event.Source.GroupID != "" {
+			target = event.Source.GroupID
+			if profile, err := api.GetGroupMemberProfile(event.Source.GroupID, event.Source.UserID); err == nil {
+				if err = api.PushMessage(target, linebot.NewTextMessage(profile.DisplayName+"Don't be shy to recall messages, برای نمایش پروفایل ، me را تایپ کنید!")); err != nil {
+					log.Print(err)
 				}
-			case message.Text=="1":
-				bot.ReplyMessage(replyToken, linebot.NewTextMessage("💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀\n\n─═≡ϻఠ_ఠsɛɳ≡═─\n\n.1.2.3.4.5.6.7.8.9.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J\n\n─═≡ϻఠ_ఠsɛɳ≡═─\n\n.1.2.3.4.5.6.7.8.9.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9..0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.\n\n💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀"), linebot.NewTextMessage("7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7."), linebot.NewTextMessage("7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7."), linebot.NewTextMessage("7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7.7W0.G7.W0.G7W0.G7.W0.G7W0.G7.W0.G7W0.G7."), linebot.NewTextMessage("💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀\n\n─═≡ϻఠ_ఠsɛɳ≡═─\n\n.1.2.3.4.5.6.7.8.9.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J\n\n─═≡ϻఠ_ఠsɛɳ≡═─\n\n.1.2.3.4.5.6.7.8.9.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9..0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.8.J.9.K.0.A.1.B.2.D.3.E.4.F.5.G.6.H.7.I.\n\n💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀💀")).Do()
+			}
+		} else {
+			target = event.Source.RoomID
+			if profile, err := api.GetRoomMemberProfile(event.Source.RoomID, event.Source.UserID); err == nil {
+				if err = api.PushMessage(target, linebot.NewTextMessage(profile.DisplayName+" برای نمایش اطلاعات ، /me را تایپ کنید!")); err != nil {
+					log.Print(err)
 				}
+			}
+		}
 
-		case linebot.EventTypeMessage:
-			switch message := event.Message.(type) {
-			case *linebot.TextMessage:
-				switch {
-				case event.Source.GroupID != "":
-					//In the group
-					if strings.EqualFold(message.Text, "/bye") {
-						if _, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage("┄┅✿:❀خـٍٍٍٖۡـدانگهـٍٍٍٖۡـدار  دوستـٍٍٍٖۡـان❀:✿┅┄")).Do(); err != nil {
-							log.Print(err)
-						}
-						bot.LeaveGroup(event.Source.GroupID).Do()
-					} else {
-						if strings.EqualFold(message.Text, "/me") {
-							//Response with get member profile
-							if profile, err := bot.GetGroupMemberProfile(event.Source.GroupID, event.Source.UserID).Do(); err == nil {
-								sendUserProfile(*profile, event)
-							}
-						}
+	case linebot.EventTypeMessage:
+		members.touch(event.Source)
+		runMessageHooks(api, event)
+		switch message := event.Message.(type) {
+		case *linebot.TextMessage:
+			switch {
+			case dispatchCommand(api, event, message.Text):
+				// Handled by a registered command.
+			case answerQuiz(event, message.Text):
+				// Taken as an answer to a running quiz.
+			case event.Source.GroupID != "":
+				//In the group
+				if strings.EqualFold(message.Text, "/bye") {
+					if err = api.ReplyMessage(event.ReplyToken, linebot.NewTextMessage("┄┅✿:❀خـٍٍٍٖۡـدانگهـٍٍٍٖۡـدار  دوستـٍٍٍٖۡـان❀:✿┅┄")); err != nil {
+						log.Print(err)
 					}
-
-				case event.Source.RoomID != "":
-					//In the room
-					if strings.EqualFold(message.Text, "/bye") {
-						if _, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(" Bye bye!")).Do(); err != nil {
-							log.Print(err)
-						}
-						bot.LeaveRoom(event.Source.RoomID).Do()
-					} else {
-						if strings.EqualFold(message.Text, "/me") {
-							//Response with get member profile
-							if profile, err := bot.GetRoomMemberProfile(event.Source.RoomID, event.Source.UserID).Do(); err == nil {
-								sendUserProfile(*profile, event)
-							}
+					if err = api.LeaveGroup(event.Source.GroupID); err == nil {
+						left(event.Source.GroupID, event.Source.UserID)
+					}
+				} else {
+					if strings.EqualFold(message.Text, "/me") {
+						//Response with get member profile
+						if profile, err := api.GetGroupMemberProfile(event.Source.GroupID, event.Source.UserID); err == nil {
+							sendUserProfile(api, *profile, event)
 						}
 					}
-				default:
-					if _, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(" سلام :"+message.Text+" OK!")).Do(); err != nil {
+				}
+
+			case event.Source.RoomID != "":
+				//In the room
+				if strings.EqualFold(message.Text, "/bye") {
+					if err = api.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(" Bye bye!")); err != nil {
 						log.Print(err)
 					}
-				}
-			}
-				 
-		case linebot.EventTypeJoin:
-			// If join into a Group
-			if event.Source.GroupID != "" {
-				if groupRes, err := bot.GetGroupSummary(event.Source.GroupID).Do(); err == nil {
-					if goupMemberResult, err := bot.GetGroupMemberCount(event.Source.GroupID).Do(); err == nil {
-						retString := fmt.Sprintf("سلام دوستان\n\n متشکرم که اجازه\n\n دادید به این گروه بپیوندم\n\n\n\n┅━═::✾::═━┅\n ـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـــ۪ٜ۪ٜ۪ٜ۪ٜ۟۟۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۟۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۟۟۟۟۟۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۟۟۟۟۟۟۟۫۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۟۟۟۟۟۟۟۟۟۟۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۟۟۟۟۟۟۟۟۟۟۫۟۟۟۫۫۫۫ـ۪۪ٜ۟۟۟۟۟۟۟۟۟۟۟۟۟۟۫۫ـــ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـــ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۫۫ۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤ\n \n\nline.me/ti/p/~m_bw\n███████████\n███░███░███\n☆ܦܓܚܔ☆═►\n", groupRes.GroupName, goupMemberResult.Count)
-						if _, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(retString), linebot.NewImageMessage(groupRes.PictureURL, groupRes.PictureURL)).Do(); err != nil {
-							//Reply fail.
-							log.Print(err)
-						}
-					} else {
-						//GetGroupMemberCount fail.
-						log.Printf("GetGroupMemberCount:%x", err)
+					if err = api.LeaveRoom(event.Source.RoomID); err == nil {
+						left(event.Source.RoomID, event.Source.UserID)
 					}
 				} else {
-					//GetGroupSummary fail/.
-					log.Printf("GetGroupSummary:%x", err)
+					if strings.EqualFold(message.Text, "/me") {
+						//Response with get member profile
+						if profile, err := api.GetRoomMemberProfile(event.Source.RoomID, event.Source.UserID); err == nil {
+							sendUserProfile(api, *profile, event)
+						}
+					}
 				}
-			} else if event.Source.RoomID != "" {
-				// If join into a Room
-				if goupMemberResult, err := bot.GetRoomMemberCount(event.Source.RoomID).Do(); err == nil {
-					retString := fmt.Sprintf("سلام دوستان\n\n متشکرم که اجازه\n\n دادید به این گروه بپیوندم\n\n\n\n┅━═::✾::═━┅\n ـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـــ۪ٜ۪ٜ۪ٜ۪ٜ۟۟۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۟۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۟۟۟۟۟۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۟۟۟۟۟۟۟۫۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۟۟۟۟۟۟۟۟۟۟۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۟۟۟۟۟۟۟۟۟۟۫۟۟۟۫۫۫۫ـ۪۪ٜ۟۟۟۟۟۟۟۟۟۟۟۟۟۟۫۫ـــ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـــ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۫۫ۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤ\n \n\nline.me/ti/p/~m_bw\n███████████\n███░███░███\n☆ܦܓܚܔ☆═►\n", goupMemberResult.Count)
-					if _, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(retString)).Do(); err != nil {
+			default:
+				replyPrivately(api, event)
+			}
+		}
+
+	case linebot.EventTypePostback:
+		dispatchPostback(api, event)
+
+	case linebot.EventTypeMemberJoined:
+		var joinedIDs []string
+		for _, member := range event.Members {
+			profiles.forget(sourceID(event.Source), member.UserID)
+			joinedIDs = append(joinedIDs, member.UserID)
+		}
+		digests.joined(sourceID(event.Source), joinedIDs)
+		// Show the rules to new members
+		if rules := rulesMessage(sourceID(event.Source)); rules != nil {
+			var names []string
+			for _, member := range event.Members {
+				names = append(names, displayName(event.Source, member.UserID))
+			}
+			welcome := linebot.NewTextMessage("👋 " + strings.Join(names, ", ") + ", welcome! Please read our rules.")
+			if err = api.ReplyMessage(event.ReplyToken, welcome, rules); err != nil {
+				log.Print(err)
+			}
+		}
+
+	case linebot.EventTypeMemberLeft:
+		for _, member := range event.Members {
+			members.forget(sourceID(event.Source), member.UserID)
+			digests.left(sourceID(event.Source), member.UserID, profiles.name(sourceID(event.Source), member.UserID))
+			profiles.gone(sourceID(event.Source), member.UserID)
+		}
+
+	case linebot.EventTypeFollow:
+		welcome(api, event)
+
+	case linebot.EventTypeUnfollow:
+		unfollowed(event.Source.UserID)
+
+	case linebot.EventTypeLeave:
+		left(sourceID(event.Source), "")
+
+	case linebot.EventTypeJoin:
+		joined(sourceID(event.Source), "")
+		// If join into a Group
+		if event.Source.GroupID != "" {
+			if groupRes, err := api.GetGroupSummary(event.Source.GroupID); err == nil {
+				if count, err := api.GetGroupMemberCount(event.Source.GroupID); err == nil {
+					retString := fmt.Sprintf("سلام دوستان\n\n متشکرم که اجازه\n\n دادید به این گروه بپیوندم\n\n\n\n┅━═::✾::═━┅\n ـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـــ۪ٜ۪ٜ۪ٜ۪ٜ۟۟۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۟۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۟۟۟۟۟۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۟۟۟۟۟۟۟۫۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۟۟۟۟۟۟۟۟۟۟۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۟۟۟۟۟۟۟۟۟۟۫۟۟۟۫۫۫۫ـ۪۪ٜ۟۟۟۟۟۟۟۟۟۟۟۟۟۟۫۫ـــ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـــ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۫۫ۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤ\n \n\nline.me/ti/p/~m_bw\n███████████\n███░███░███\n☆ܦܓܚܔ☆═►\n\n%s (%d)", groupRes.GroupName, count)
+					messages := []linebot.SendingMessage{linebot.NewTextMessage(retString), linebot.NewImageMessage(groupRes.PictureURL, groupRes.PictureURL)}
+					if rules := rulesMessage(event.Source.GroupID); rules != nil {
+						messages = append(messages, rules)
+					}
+					if err = api.ReplyMessage(event.ReplyToken, messages...); err != nil {
 						//Reply fail.
 						log.Print(err)
 					}
 				} else {
-					//GetRoomMemberCount fail.
-					log.Printf("GetRoomMemberCount:%x", err)
+					//GetGroupMemberCount fail.
+					log.Printf("GetGroupMemberCount:%x", err)
 				}
+			} else {
+				//GetGroupSummary fail/.
+				log.Printf("GetGroupSummary:%x", err)
+			}
+		} else if event.Source.RoomID != "" {
+			// If join into a Room
+			if count, err := api.GetRoomMemberCount(event.Source.RoomID); err == nil {
+				retString := fmt.Sprintf("سلام دوستان\n\n متشکرم که اجازه\n\n دادید به این گروه بپیوندم\n\n\n\n┅━═::✾::═━┅\n ـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤ۟۟۟۟ۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـــ۪ٜ۪ٜ۪ٜ۪ٜ۟۟۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۟۟۟۟۟ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۟۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۟۟۟۟۟۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۟۟۟۟۟۟۟۫۫۫۫۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۟۟۟۟۟۟۟۟۟۟۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۟۟۟۟۟۟۟۟۟۟۫۟۟۟۫۫۫۫ـ۪۪ٜ۟۟۟۟۟۟۟۟۟۟۟۟۟۟۫۫ـــ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤ۟۟۟۟۟۟۟۟۟۟۟۟ۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـ۪۪ٜ۫۫۫۫۫۫۫۫۫۫۫۫۫۫ـــ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۫۫ۤۤۤۤۤۤۤۤۤـ۪۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤـ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪۪ٜ۪ٜ۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤـ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪ٜ۪۫۫ۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤۤ\n \n\nline.me/ti/p/~m_bw\n███████████\n███░███░███\n☆ܦܓܚܔ☆═►\n\n(%d)", count)
+				messages := []linebot.SendingMessage{linebot.NewTextMessage(retString)}
+				if rules := rulesMessage(event.Source.RoomID); rules != nil {
+					messages = append(messages, rules)
+				}
+				if err = api.ReplyMessage(event.ReplyToken, messages...); err != nil {
+					//Reply fail.
+					log.Print(err)
+				}
+			} else {
+				//GetRoomMemberCount fail.
+				log.Printf("GetRoomMemberCount:%x", err)
 			}
 		}
 	}
 }
 
-func sendUserProfile(user linebot.UserProfileResponse, event *linebot.Event) {
-	retString := fmt.Sprintf("\n سـٰٖۘۘۘۘـٍٍٍـلام  دوسـٰٖۘۘۘۘـٍٍٍـت  عزیـٰٖۘۘۘۘـٍٍٍـز\n\n\n", user.DisplayName, user.UserID, user.Language, user.StatusMessage)
-	if _, err := bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(retString), linebot.NewImageMessage(user.PictureURL, user.PictureURL)).Do(); err != nil {
+func sendUserProfile(api botAPI, user linebot.UserProfileResponse, event *linebot.Event) {
+	retString := fmt.Sprintf("\n سـٰٖۘۘۘۘـٍٍٍـلام  دوسـٰٖۘۘۘۘـٍٍٍـت  عزیـٰٖۘۘۘۘـٍٍٍـز\n\n%s\n", user.DisplayName)
+	if err := api.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(retString), linebot.NewImageMessage(user.PictureURL, user.PictureURL)); err != nil {
 		//Reply fail.
 		log.Print(err)
 	}
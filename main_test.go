@@ -0,0 +1,344 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "linebot-group")
+	if err != nil {
+		panic(err)
+	}
+	db = newStore(dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// useFake makes a fake the only channel's API.
+func useFake(t *testing.T) *fakeAPI {
+	t.Helper()
+	f := newFakeAPI()
+	f.profiles["U1"] = &linebot.UserProfileResponse{UserID: "U1", DisplayName: "Alice", PictureURL: "https://example.com/alice.jpg"}
+	f.summary = &linebot.GroupSummaryResponse{GroupID: "G1", GroupName: "Friends", PictureURL: "https://example.com/friends.jpg"}
+	f.count = 5
+	c, err := linebot.New("secret", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultChannel = &channel{Name: "test", client: c, api: f}
+	channels = map[string]*channel{"test": defaultChannel}
+	chatViews.views = map[string]cachedView{}
+	return f
+}
+
+var (
+	inGroup = &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: "U1"}
+	inRoom  = &linebot.EventSource{Type: linebot.EventSourceTypeRoom, RoomID: "R1", UserID: "U1"}
+	inChat  = &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}
+)
+
+func textEvent(src *linebot.EventSource, text string) *linebot.Event {
+	return &linebot.Event{
+		Type:       linebot.EventTypeMessage,
+		ReplyToken: "T",
+		Source:     src,
+		Message:    &linebot.TextMessage{ID: "M1", Text: text},
+	}
+}
+
+// checkCalls compares calls with want, each of which must be contained in
+// the call at the same position.
+func checkCalls(t *testing.T, calls, want []string) {
+	t.Helper()
+	if len(calls) != len(want) {
+		t.Fatalf("got calls\n  %s\nwant\n  %s", strings.Join(calls, "\n  "), strings.Join(want, "\n  "))
+	}
+	for i := range want {
+		if !strings.Contains(calls[i], want[i]) {
+			t.Errorf("call %d is %q, want it to contain %q", i, calls[i], want[i])
+		}
+	}
+}
+
+// waitForCall waits until f has been called with a call containing want,
+// for hooks that work in the background.
+func waitForCall(t *testing.T, f *fakeAPI, want string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		for _, call := range f.Calls() {
+			if strings.Contains(call, want) {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no call contains %q: %q", want, f.Calls())
+}
+
+func TestHandleEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *linebot.Event
+		failing string
+		rules   string
+		want    []string
+	}{{
+		name:  "unsend in group",
+		event: &linebot.Event{Type: linebot.EventTypeUnsend, Source: inGroup},
+		want:  []string{"group profile G1 U1", "push G1: AliceDon't be shy to recall messages"},
+	}, {
+		name:    "unsend in group, profile lookup fails",
+		event:   &linebot.Event{Type: linebot.EventTypeUnsend, Source: inGroup},
+		failing: "GetGroupMemberProfile",
+		want:    []string{"group profile G1 U1"},
+	}, {
+		name:  "unsend in room",
+		event: &linebot.Event{Type: linebot.EventTypeUnsend, Source: inRoom},
+		want:  []string{"room profile R1 U1", "push R1: Alice برای نمایش اطلاعات"},
+	}, {
+		name:    "unsend in room, profile lookup fails",
+		event:   &linebot.Event{Type: linebot.EventTypeUnsend, Source: inRoom},
+		failing: "GetRoomMemberProfile",
+		want:    []string{"room profile R1 U1"},
+	}, {
+		name:  "bye in group",
+		event: textEvent(inGroup, "/Bye"),
+		want:  []string{"reply T: ┄┅✿", "leave group G1"},
+	}, {
+		name:  "me in group",
+		event: textEvent(inGroup, "/me"),
+		want:  []string{"group profile G1 U1", "Alice\n | image:https://example.com/alice.jpg"},
+	}, {
+		name:    "me in group, profile lookup fails",
+		event:   textEvent(inGroup, "/me"),
+		failing: "GetGroupMemberProfile",
+		want:    []string{"group profile G1 U1"},
+	}, {
+		name:  "other text in group",
+		event: textEvent(inGroup, "hello"),
+	}, {
+		name:  "bye in room",
+		event: textEvent(inRoom, "/bye"),
+		want:  []string{"reply T:  Bye bye!", "leave room R1"},
+	}, {
+		name:  "me in room",
+		event: textEvent(inRoom, "/ME"),
+		want:  []string{"room profile R1 U1", "image:https://example.com/alice.jpg"},
+	}, {
+		name:    "me in room, profile lookup fails",
+		event:   textEvent(inRoom, "/me"),
+		failing: "GetRoomMemberProfile",
+		want:    []string{"room profile R1 U1"},
+	}, {
+		name:  "other text in room",
+		event: textEvent(inRoom, "hello"),
+	}, {
+		name:  "text in one-on-one chat",
+		event: textEvent(inChat, "hello"),
+		want:  []string{"reply T: I did not understand that."},
+	}, {
+		name:  "registered command",
+		event: textEvent(inGroup, "/roll 2d6 #42"),
+		want:  []string{"reply T: 🎲 2d6: "},
+	}, {
+		name:  "replayed draw",
+		event: textEvent(inGroup, "/flip #42"),
+		want:  []string{"🔁 replay of #42, not a new draw"},
+	}, {
+		name:  "sticker message",
+		event: &linebot.Event{Type: linebot.EventTypeMessage, ReplyToken: "T", Source: inGroup, Message: &linebot.StickerMessage{ID: "M2", PackageID: "446", StickerID: "1988"}},
+	}, {
+		name:  "postback running a command",
+		event: &linebot.Event{Type: linebot.EventTypePostback, ReplyToken: "T", Source: inGroup, Postback: &linebot.Postback{Data: "/flip"}},
+		want:  []string{"reply T: 🪙"},
+	}, {
+		name:  "unknown postback",
+		event: &linebot.Event{Type: linebot.EventTypePostback, ReplyToken: "T", Source: inGroup, Postback: &linebot.Postback{Data: "a=nothing"}},
+	}, {
+		name:  "member joined without rules",
+		event: &linebot.Event{Type: linebot.EventTypeMemberJoined, ReplyToken: "T", Source: inGroup, Members: []*linebot.EventSource{{UserID: "U1"}}},
+	}, {
+		name:  "member joined with rules",
+		event: &linebot.Event{Type: linebot.EventTypeMemberJoined, ReplyToken: "T", Source: inGroup, Members: []*linebot.EventSource{{UserID: "U1"}}},
+		rules: "Be kind",
+		want:  []string{"group profile G1 U1", "reply T: 👋 Alice, welcome! Please read our rules. | 📜 Rules\n\nBe kind"},
+	}, {
+		name:  "member left",
+		event: &linebot.Event{Type: linebot.EventTypeMemberLeft, Source: inGroup, Members: []*linebot.EventSource{{UserID: "U1"}}},
+	}, {
+		name:  "join group",
+		event: &linebot.Event{Type: linebot.EventTypeJoin, ReplyToken: "T", Source: inGroup},
+		want:  []string{"group summary G1", "group count G1", "Friends (5) | image:https://example.com/friends.jpg"},
+	}, {
+		name:  "join group with rules",
+		event: &linebot.Event{Type: linebot.EventTypeJoin, ReplyToken: "T", Source: inGroup},
+		rules: "Be kind",
+		want:  []string{"group summary G1", "group count G1", "Friends (5) | image:https://example.com/friends.jpg | 📜 Rules"},
+	}, {
+		name:    "join group, summary fails",
+		event:   &linebot.Event{Type: linebot.EventTypeJoin, ReplyToken: "T", Source: inGroup},
+		failing: "GetGroupSummary",
+		want:    []string{"group summary G1"},
+	}, {
+		name:    "join group, count fails",
+		event:   &linebot.Event{Type: linebot.EventTypeJoin, ReplyToken: "T", Source: inGroup},
+		failing: "GetGroupMemberCount",
+		want:    []string{"group summary G1", "group count G1"},
+	}, {
+		name:    "join group, reply fails",
+		event:   &linebot.Event{Type: linebot.EventTypeJoin, ReplyToken: "T", Source: inGroup},
+		failing: "ReplyMessage",
+		want:    []string{"group summary G1", "group count G1", "reply T: "},
+	}, {
+		name:  "join room",
+		event: &linebot.Event{Type: linebot.EventTypeJoin, ReplyToken: "T", Source: inRoom},
+		want:  []string{"room count R1", "(5)"},
+	}, {
+		name:    "join room, count fails",
+		event:   &linebot.Event{Type: linebot.EventTypeJoin, ReplyToken: "T", Source: inRoom},
+		failing: "GetRoomMemberCount",
+		want:    []string{"room count R1"},
+	}, {
+		name:  "follow",
+		event: &linebot.Event{Type: linebot.EventTypeFollow, ReplyToken: "T", Source: inChat},
+		want:  []string{"profile U1", "reply T: Hi Alice! 👋 Thanks for adding me. | I help groups"},
+	}, {
+		name:    "follow, profile fails",
+		event:   &linebot.Event{Type: linebot.EventTypeFollow, ReplyToken: "T", Source: inChat},
+		failing: "GetProfile",
+		want:    []string{"profile U1", "reply T: Hi! 👋"},
+	}, {
+		name:  "unfollow",
+		event: &linebot.Event{Type: linebot.EventTypeUnfollow, Source: inChat},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFake(t)
+			if tt.failing != "" {
+				f.failing[tt.failing] = true
+			}
+			id := sourceID(tt.event.Source)
+			notebook.update(id, func(c *chatNotes) { c.Rules = tt.rules })
+			handleEvent(f, tt.event)
+			checkCalls(t, f.Calls(), tt.want)
+		})
+	}
+}
+
+func TestCallbackHandler(t *testing.T) {
+	body := `{"events":[{"type":"message","replyToken":"T","source":{"type":"user","userId":"U1"},"timestamp":0,"message":{"type":"text","id":"M1","text":"hi"}}]}`
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	defer func() { chatChannels.Chats = map[string]string{} }()
+
+	// Each path must be checked with its own channel's secret and answered
+	// through its own channel.
+	tests := []struct {
+		name      string
+		path      string
+		signature string
+		status    int
+		want      []string
+		wantShop  []string
+	}{
+		{"default channel", "/callback", sign("secret"), http.StatusOK, []string{"reply T: I did not understand that."}, nil},
+		{"default channel by name", "/callback/test", sign("secret"), http.StatusOK, []string{"reply T: I did not understand that."}, nil},
+		{"named channel", "/callback/shop", sign("shop secret"), http.StatusOK, nil, []string{"reply T: I did not understand that."}},
+		{"named channel, trailing slash", "/callback/shop/", sign("shop secret"), http.StatusOK, nil, []string{"reply T: I did not understand that."}},
+		{"named channel, default secret", "/callback/shop", sign("secret"), http.StatusBadRequest, nil, nil},
+		{"default channel, named secret", "/callback", sign("shop secret"), http.StatusBadRequest, nil, nil},
+		{"unknown channel", "/callback/other", sign("secret"), http.StatusNotFound, nil, nil},
+		{"bad signature", "/callback", "AAAA", http.StatusBadRequest, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFake(t)
+			shop := newFakeAPI()
+			client, err := linebot.New("shop secret", "shop token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			channels["shop"] = &channel{Name: "shop", client: client, api: shop}
+			chatChannels.Chats = map[string]string{}
+
+			r := httptest.NewRequest("POST", tt.path, strings.NewReader(body))
+			r.Header.Set("X-Line-Signature", tt.signature)
+			w := httptest.NewRecorder()
+			callbackHandler(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+			checkCalls(t, f.Calls(), tt.want)
+			checkCalls(t, shop.Calls(), tt.wantShop)
+			if tt.wantShop != nil && channelFor("U1").Name != "shop" {
+				t.Errorf("U1 is bound to channel %s, want shop", channelFor("U1").Name)
+			}
+		})
+	}
+}
+
+func TestSendUserProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		failing string
+	}{
+		{"reply sent", ""},
+		{"reply fails", "ReplyMessage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFake(t)
+			f.failing[tt.failing] = true
+			sendUserProfile(f, *f.profiles["U1"], textEvent(inChat, "/me"))
+			checkCalls(t, f.Calls(), []string{"Alice\n | image:https://example.com/alice.jpg"})
+		})
+	}
+}
+
+func TestRepliesUseReceivingChannel(t *testing.T) {
+	bound := useFake(t)
+	receiving := newFakeAPI()
+	receiving.content = "not an image"
+	reposts.Chats = map[string]*chatImages{"G1": {Enabled: true, Threshold: repostThreshold}}
+	defer func() { reposts.Chats = map[string]*chatImages{} }()
+
+	// G1 is bound to the default channel, but another channel in the group
+	// delivers these events: only its reply tokens and message IDs work.
+	handleEvent(receiving, textEvent(inGroup, "/flip"))
+	handleEvent(receiving, &linebot.Event{Type: linebot.EventTypePostback, ReplyToken: "T", Source: inGroup, Postback: &linebot.Postback{Data: "/flip"}})
+	handleEvent(receiving, &linebot.Event{Type: linebot.EventTypeMessage, ReplyToken: "T", Source: inGroup, Message: &linebot.ImageMessage{ID: "M9"}})
+	waitForCall(t, receiving, "content M9")
+	checkCalls(t, receiving.Calls(), []string{"reply T: 🪙", "reply T: 🪙", "content M9"})
+	for _, call := range bound.Calls() {
+		if strings.HasPrefix(call, "reply") || strings.HasPrefix(call, "content") {
+			t.Errorf("the bound channel was used for %q", call)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// members remembers who has been active in each group and room.
+var members = &memberBook{Seen: map[string]map[string]time.Time{}}
+
+// memberBook maps a group or room ID to its users and when each was last seen.
+type memberBook struct {
+	mu    sync.Mutex
+	saved time.Time
+	Seen  map[string]map[string]time.Time `json:"seen"`
+}
+
+func (m *memberBook) load() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := db.load("members", m); err != nil {
+		log.Print(err)
+	}
+}
+
+// touch marks userID as active in the chat of src. New members are written
+// out at once; activity of known members at most once a minute.
+func (m *memberBook) touch(src *linebot.EventSource) {
+	id := sourceID(src)
+	if src.UserID == "" || id == src.UserID {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := m.Seen[id]
+	if users == nil {
+		users = map[string]time.Time{}
+		m.Seen[id] = users
+	}
+	_, known := users[src.UserID]
+	users[src.UserID] = time.Now()
+	if known && time.Since(m.saved) < time.Minute {
+		return
+	}
+	m.saved = time.Now()
+	if err := db.save("members", m); err != nil {
+		log.Print(err)
+	}
+}
+
+// forget drops userID from the chat id, e.g. after a memberLeft event.
+func (m *memberBook) forget(id, userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.Seen[id][userID]; !ok {
+		return
+	}
+	delete(m.Seen[id], userID)
+	if err := db.save("members", m); err != nil {
+		log.Print(err)
+	}
+}
+
+// forgetChat drops everyone seen in chat id.
+func (m *memberBook) forgetChat(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.Seen[id]; !ok {
+		return
+	}
+	delete(m.Seen, id)
+	if err := db.save("members", m); err != nil {
+		log.Print(err)
+	}
+}
+
+// active returns the users seen in the chat id within d, or all of them when
+// d is zero, sorted by user ID.
+func (m *memberBook) active(id string, d time.Duration) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for userID, seen := range m.Seen[id] {
+		if d == 0 || time.Since(seen) <= d {
+			ids = append(ids, userID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// sourceID returns the group or room an event came from, or the user in a
+// one-on-one chat.
+func sourceID(src *linebot.EventSource) string {
+	switch {
+	case src.GroupID != "":
+		return src.GroupID
+	case src.RoomID != "":
+		return src.RoomID
+	}
+	return src.UserID
+}
+
+// memberProfile looks up userID in the group or room of src.
+func memberProfile(src *linebot.EventSource, userID string) (*linebot.UserProfileResponse, error) {
+	switch {
+	case src.GroupID != "":
+		return botFor(src).GetGroupMemberProfile(src.GroupID, userID)
+	case src.RoomID != "":
+		return botFor(src).GetRoomMemberProfile(src.RoomID, userID)
+	}
+	return botFor(src).GetProfile(userID)
+}
+
+// displayName is the member's profile name, or a placeholder if the lookup
+// fails.
+func displayName(src *linebot.EventSource, userID string) string {
+	profile, err := memberProfile(src, userID)
+	if err != nil {
+		log.Print(err)
+		return "(unknown)"
+	}
+	return profile.DisplayName
+}
+
+// memberIDs lists everyone in the group or room of src, sorted. The member ID
+// API is limited to verified and premium accounts, so other bots fall back to
+// the members seen so far.
+func memberIDs(src *linebot.EventSource) []string {
+	var ids []string
+	next := ""
+	for {
+		var res *linebot.MemberIDsResponse
+		var err error
+		switch {
+		case src.GroupID != "":
+			res, err = botFor(src).GetGroupMemberIDs(src.GroupID, next)
+		case src.RoomID != "":
+			res, err = botFor(src).GetRoomMemberIDs(src.RoomID, next)
+		default:
+			return []string{src.UserID}
+		}
+		if err != nil {
+			return members.active(sourceID(src), 0)
+		}
+		ids = append(ids, res.MemberIDs...)
+		if res.Next == "" {
+			break
+		}
+		next = res.Next
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// mentions returns the users mentioned in a text message event.
+func mentions(event *linebot.Event) []string {
+	message, ok := event.Message.(*linebot.TextMessage)
+	if !ok || message.Mention == nil {
+		return nil
+	}
+	var userIDs []string
+	for _, m := range message.Mention.Mentionees {
+		if m.UserID != "" {
+			userIDs = append(userIDs, m.UserID)
+		}
+	}
+	return userIDs
+}
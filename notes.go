@@ -0,0 +1,375 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	noteImageWait    = 5 * time.Minute
+	notesPerBubble   = 10
+	maxNoteNameRunes = 30
+)
+
+func init() {
+	registerCommand("rules", rulesCommand)
+	registerCommand("note", noteCommand)
+	registerCommand("notes", noteCommand)
+	registerHelp("rules", commandHelp{
+		Summary:    "Show or change the rules of the group",
+		SummaryFa:  "نمایش یا تغییر قوانین گروه",
+		Usage:      []string{"/rules"},
+		AdminUsage: []string{"/rules set Be kind.", "/rules clear"},
+		Where:      inShared,
+	})
+	registerHelp("note", commandHelp{
+		Summary:    "Read and write the notes of the group",
+		SummaryFa:  "خواندن و نوشتن یادداشت‌های گروه",
+		Usage:      []string{"/note", "/note wifi"},
+		AdminUsage: []string{"/note set wifi The password is on the fridge", "/note image logo", "/note delete wifi"},
+		Where:      inShared,
+	})
+	registerHelp("notes", commandHelp{
+		Summary:   "List the notes of the group",
+		SummaryFa: "فهرست یادداشت‌های گروه",
+		Usage:     []string{"/notes"},
+		Where:     inShared,
+	})
+	registerMessageHook(noteImageHook)
+}
+
+// note is a pinned note. Image is the hash of stored content.
+type note struct {
+	Text    string    `json:"text,omitempty"`
+	Image   string    `json:"image,omitempty"`
+	By      string    `json:"by"`
+	Updated time.Time `json:"updated"`
+}
+
+type chatNotes struct {
+	Rules string           `json:"rules,omitempty"`
+	Notes map[string]*note `json:"notes,omitempty"`
+}
+
+// notebook holds the rules and notes of every group and room.
+var notebook = &noteBook{Chats: map[string]*chatNotes{}}
+
+type noteBook struct {
+	mu    sync.Mutex
+	Chats map[string]*chatNotes `json:"chats"`
+}
+
+func (n *noteBook) load() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := db.load("notes", n); err != nil {
+		log.Print(err)
+	}
+}
+
+// update changes the notes of chat id with fn and saves them.
+func (n *noteBook) update(id string, fn func(c *chatNotes)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	c := n.Chats[id]
+	if c == nil {
+		c = &chatNotes{}
+		n.Chats[id] = c
+	}
+	if c.Notes == nil {
+		c.Notes = map[string]*note{}
+	}
+	fn(c)
+	if err := db.save("notes", n); err != nil {
+		log.Print(err)
+	}
+}
+
+func (n *noteBook) rules(id string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if c := n.Chats[id]; c != nil {
+		return c.Rules
+	}
+	return ""
+}
+
+func (n *noteBook) note(id, name string) (note, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if c := n.Chats[id]; c != nil && c.Notes[name] != nil {
+		return *c.Notes[name], true
+	}
+	return note{}, false
+}
+
+func (n *noteBook) names(id string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var names []string
+	if c := n.Chats[id]; c != nil {
+		for name := range c.Notes {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// forgetChat deletes the notes of chat id. Its rules are an admin setting,
+// so they are kept for when the chatbot is added back.
+func (n *noteBook) forgetChat(id string) {
+	n.mu.Lock()
+	c := n.Chats[id]
+	if c == nil || len(c.Notes) == 0 {
+		n.mu.Unlock()
+		return
+	}
+	if c.Rules == "" {
+		delete(n.Chats, id)
+	} else {
+		n.Chats[id] = &chatNotes{Rules: c.Rules}
+	}
+	if err := db.save("notes", n); err != nil {
+		log.Print(err)
+	}
+	n.mu.Unlock()
+	for _, nt := range c.Notes {
+		if nt.Image != "" {
+			removeUnusedContent(nt.Image)
+		}
+	}
+}
+
+// references reports whether any note uses the content hash.
+func (n *noteBook) references(hash string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, c := range n.Chats {
+		for _, nt := range c.Notes {
+			if nt.Image == hash {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rulesMessage is the rules of chat id as a message, or nil if none are set.
+func rulesMessage(id string) linebot.SendingMessage {
+	rules := notebook.rules(id)
+	if rules == "" {
+		return nil
+	}
+	return linebot.NewTextMessage("📜 Rules\n\n" + rules)
+}
+
+func rulesCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	id := sourceID(event.Source)
+	sub := ""
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	switch sub {
+	case "":
+		if m := rulesMessage(id); m != nil {
+			return []linebot.SendingMessage{m}
+		}
+		return textReplyf("No rules have been set. Admins can set them with /rules set <text>.")
+	case "set", "clear":
+		if !isAdmin(event.Source) {
+			return textReplyf("Only admins can change the rules.")
+		}
+		text := restText(event, 1)
+		if sub == "set" && text == "" {
+			return textReplyf("Usage: /rules set <text>")
+		}
+		if sub == "clear" {
+			text = ""
+		}
+		notebook.update(id, func(c *chatNotes) { c.Rules = text })
+		if text == "" {
+			return textReplyf("Rules cleared.")
+		}
+		return textReplyf("Rules saved. New members will see them when they join.")
+	}
+	return textReplyf("Usage: /rules, /rules set <text>, /rules clear")
+}
+
+// pendingImages maps chat and user to the note waiting for their image.
+var pendingImages = struct {
+	sync.Mutex
+	notes map[string]pendingImage
+}{notes: map[string]pendingImage{}}
+
+type pendingImage struct {
+	name  string
+	until time.Time
+}
+
+func noteCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	id := sourceID(event.Source)
+	if len(args) == 0 {
+		return noteIndex(id)
+	}
+	sub := strings.ToLower(args[0])
+	switch sub {
+	case "set", "image", "delete":
+		if len(args) < 2 {
+			break
+		}
+		if !isAdmin(event.Source) {
+			return textReplyf("Only admins can change notes.")
+		}
+		name := strings.ToLower(args[1])
+		if len([]rune(name)) > maxNoteNameRunes {
+			return textReplyf("Note names can be at most %d characters.", maxNoteNameRunes)
+		}
+		switch sub {
+		case "set":
+			text := restText(event, 2)
+			if text == "" {
+				return textReplyf("Usage: /note set <name> <text>")
+			}
+			notebook.update(id, func(c *chatNotes) {
+				n := c.Notes[name]
+				if n == nil {
+					n = &note{}
+					c.Notes[name] = n
+				}
+				n.Text, n.By, n.Updated = text, event.Source.UserID, time.Now()
+			})
+			return textReplyf("📌 Note %q saved. Show it with /note %s", name, name)
+		case "image":
+			pendingImages.Lock()
+			pendingImages.notes[id+"/"+event.Source.UserID] = pendingImage{name, time.Now().Add(noteImageWait)}
+			pendingImages.Unlock()
+			return textReplyf("Send the image for note %q within %d minutes.", name, int(noteImageWait/time.Minute))
+		case "delete":
+			var old *note
+			notebook.update(id, func(c *chatNotes) {
+				old = c.Notes[name]
+				delete(c.Notes, name)
+			})
+			if old == nil {
+				return textReplyf("There is no note %q.", name)
+			}
+			if old.Image != "" {
+				removeUnusedContent(old.Image)
+			}
+			return textReplyf("Note %q deleted.", name)
+		}
+	case "list":
+		return noteIndex(id)
+	default:
+		return showNote(id, sub)
+	}
+	return textReplyf("Usage: /note, /note <name>, /note set <name> <text>, /note image <name>, /note delete <name>")
+}
+
+func showNote(id, name string) []linebot.SendingMessage {
+	n, ok := notebook.note(id, name)
+	if !ok {
+		return textReplyf("There is no note %q. /note lists all notes.", name)
+	}
+	var messages []linebot.SendingMessage
+	if n.Text != "" {
+		messages = append(messages, linebot.NewTextMessage("📌 "+name+"\n\n"+n.Text))
+	}
+	if u := contentURL(n.Image); n.Image != "" && u != "" {
+		messages = append(messages, linebot.NewImageMessage(u, u))
+	}
+	if len(messages) == 0 {
+		return textReplyf("Note %q is empty.", name)
+	}
+	return messages
+}
+
+// noteIndex lists the notes as buttons that show them.
+func noteIndex(id string) []linebot.SendingMessage {
+	names := notebook.names(id)
+	if len(names) == 0 {
+		return textReplyf("No notes yet. Admins can add one with /note set <name> <text>.")
+	}
+	carousel := &linebot.CarouselContainer{Type: linebot.FlexContainerTypeCarousel}
+	for start := 0; start < len(names) && len(carousel.Contents) < 10; start += notesPerBubble {
+		end := start + notesPerBubble
+		if end > len(names) {
+			end = len(names)
+		}
+		body := []linebot.FlexComponent{
+			&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: "📌 Notes", Weight: linebot.FlexTextWeightTypeBold, Size: linebot.FlexTextSizeTypeLg},
+		}
+		for _, name := range names[start:end] {
+			body = append(body, &linebot.ButtonComponent{
+				Type:   linebot.FlexComponentTypeButton,
+				Style:  linebot.FlexButtonStyleTypeLink,
+				Height: linebot.FlexButtonHeightTypeSm,
+				Action: linebot.NewMessageAction(truncate(name, 20), "/note "+name),
+			})
+		}
+		carousel.Contents = append(carousel.Contents, &linebot.BubbleContainer{
+			Type: linebot.FlexContainerTypeBubble,
+			Body: &linebot.BoxComponent{Type: linebot.FlexComponentTypeBox, Layout: linebot.FlexBoxLayoutTypeVertical, Contents: body},
+		})
+	}
+	return []linebot.SendingMessage{linebot.NewFlexMessage(truncate("Notes: "+strings.Join(names, ", "), 400), carousel)}
+}
+
+// noteImageHook stores an image sent after /note image as that note's image.
+func noteImageHook(api botAPI, event *linebot.Event) {
+	image, ok := event.Message.(*linebot.ImageMessage)
+	if !ok {
+		return
+	}
+	id := sourceID(event.Source)
+	key := id + "/" + event.Source.UserID
+	pendingImages.Lock()
+	pending, ok := pendingImages.notes[key]
+	delete(pendingImages.notes, key)
+	pendingImages.Unlock()
+	if !ok || time.Now().After(pending.until) {
+		return
+	}
+	hash, _, _, err := fetchContent(api, image.ID)
+	reply := fmt.Sprintf("🖼 Image saved to note %q.", pending.name)
+	if err != nil {
+		log.Print(err)
+		reply = "Sorry, the image could not be saved."
+	} else {
+		old := ""
+		notebook.update(id, func(c *chatNotes) {
+			n := c.Notes[pending.name]
+			if n == nil {
+				n = &note{}
+				c.Notes[pending.name] = n
+			}
+			old = n.Image
+			n.Image, n.By, n.Updated = hash, event.Source.UserID, time.Now()
+		})
+		if old != "" && old != hash {
+			removeUnusedContent(old)
+		}
+	}
+	if err := api.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(reply)); err != nil {
+		log.Print(err)
+	}
+}
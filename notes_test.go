@@ -0,0 +1,60 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// TestRulesOnJoin sets the rules of a room with /rules and expects them in
+// the welcome to new members and to the bot itself, until they are cleared.
+func TestRulesOnJoin(t *testing.T) {
+	f := useFake(t)
+	f.profiles["U2"] = &linebot.UserProfileResponse{UserID: "U2", DisplayName: "Bob"}
+	defer func() {
+		notebook.update("R1", func(c *chatNotes) { c.Rules = "" })
+		admins.set("R1", "U1", false)
+	}()
+	run := func(event *linebot.Event) []string {
+		t.Helper()
+		f.calls = nil
+		handleEvent(f, event)
+		return f.Calls()
+	}
+	membersJoined := &linebot.Event{Type: linebot.EventTypeMemberJoined, ReplyToken: "T", Source: inRoom, Members: []*linebot.EventSource{{UserID: "U1"}, {UserID: "U2"}}}
+	botJoined := &linebot.Event{Type: linebot.EventTypeJoin, ReplyToken: "T", Source: inRoom}
+
+	checkCalls(t, run(textEvent(inRoom, "/rules")), []string{"reply T: No rules have been set."})
+	checkCalls(t, run(textEvent(inRoom, "/rules set Be kind")), []string{"reply T: Only admins can change the rules."})
+	checkCalls(t, run(membersJoined), nil)
+
+	admins.set("R1", "U1", true)
+	checkCalls(t, run(textEvent(inRoom, "/rules set")), []string{"reply T: Usage: /rules set <text>"})
+	checkCalls(t, run(textEvent(inRoom, "/rules set Be kind.\nNo spam.")), []string{"reply T: Rules saved."})
+	checkCalls(t, run(textEvent(inRoom, "/rules")), []string{"reply T: 📜 Rules\n\nBe kind.\nNo spam."})
+	checkCalls(t, run(membersJoined), []string{
+		"room profile R1 U1",
+		"room profile R1 U2",
+		"reply T: 👋 Alice, Bob, welcome! Please read our rules. | 📜 Rules\n\nBe kind.\nNo spam.",
+	})
+	checkCalls(t, run(botJoined), []string{"room count R1", "(5) | 📜 Rules\n\nBe kind.\nNo spam."})
+
+	checkCalls(t, run(textEvent(inRoom, "/rules clear")), []string{"reply T: Rules cleared."})
+	checkCalls(t, run(membersJoined), nil)
+	if got := run(botJoined); len(got) != 2 || strings.Contains(got[1], "📜 Rules") {
+		t.Errorf("bot joined after the rules were cleared: %q", got)
+	}
+}
@@ -0,0 +1,352 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func init() {
+	registerCommand("mygroups", myGroupsCommand)
+	registerCommand("settings", settingsCommand)
+	registerHelp("mygroups", commandHelp{
+		Summary:   "List the groups you and the bot are both in",
+		SummaryFa: "گروه‌هایی که شما و ربات در آن هستید",
+		Usage:     []string{"/mygroups"},
+		Where:     inPrivate,
+	})
+	registerHelp("settings", commandHelp{
+		Summary:   "Change your language and notifications",
+		SummaryFa: "زبان و اعلان‌های شما",
+		Usage:     []string{"/settings", "/settings language fa", "/settings mute reports"},
+		Where:     inPrivate,
+	})
+	registerTexts("en", map[string]string{
+		"welcome":         "Hi %s! 👋 Thanks for adding me.",
+		"welcome.noname":  "Hi! 👋 Thanks for adding me.",
+		"welcome.groups":  "I help groups and rooms with dice and draws, quizzes, werewolf, quotes, notes, media archives and more. Invite me to one and send /help there.",
+		"help.private":    "Here you can ask for:\n/mygroups the groups we are both in\n/settings your language and notifications\n/help this list",
+		"help.unknown":    "I did not understand that.",
+		"private.only":    "Ask me that in a one-on-one chat.",
+		"mygroups.none":   "I have not seen you in any of my groups yet.",
+		"mygroups":        "We are both in:\n%s",
+		"settings":        "Language: %s\nNotifications:\n%s",
+		"settings.usage":  "Usage: /settings, /settings language <%s>, /settings mute <kind>, /settings unmute <kind>",
+		"settings.saved":  "Saved.",
+		"notify.on":       "✅ %s (%s)",
+		"notify.off":      "🔕 %s (%s)",
+		"notify.none":     "none yet",
+		"button.mygroups": "My groups",
+		"button.settings": "Settings",
+		"button.help":     "Help",
+		"button.language": "Language: %s",
+		"button.mute":     "Mute %s",
+		"button.unmute":   "Unmute %s",
+	})
+	registerTexts("fa", map[string]string{
+		"welcome":         "سلام %s! 👋 ممنون که من را اضافه کردید.",
+		"welcome.noname":  "سلام! 👋 ممنون که من را اضافه کردید.",
+		"welcome.groups":  "من در گروه‌ها با تاس و قرعه‌کشی، مسابقه، بازی گرگینه، نقل‌قول، یادداشت، آرشیو رسانه و چیزهای دیگر کمک می‌کنم. من را به یک گروه دعوت کنید و آنجا /help را بفرستید.",
+		"help.private":    "اینجا می‌توانید بپرسید:\n/mygroups گروه‌هایی که هر دو در آن هستیم\n/settings زبان و اعلان‌ها\n/help همین فهرست",
+		"help.unknown":    "متوجه نشدم.",
+		"private.only":    "این را در گفتگوی خصوصی از من بپرسید.",
+		"mygroups.none":   "هنوز شما را در هیچ‌کدام از گروه‌هایم ندیده‌ام.",
+		"mygroups":        "هر دو در این گروه‌ها هستیم:\n%s",
+		"settings":        "زبان: %s\nاعلان‌ها:\n%s",
+		"settings.saved":  "ذخیره شد.",
+		"notify.none":     "هنوز هیچ",
+		"button.mygroups": "گروه‌های من",
+		"button.settings": "تنظیمات",
+		"button.help":     "راهنما",
+		"button.language": "زبان: %s",
+		"button.mute":     "بی‌صدا کردن %s",
+		"button.unmute":   "فعال کردن %s",
+	})
+}
+
+// userPrefs are the preferences of a user who follows the bot.
+type userPrefs struct {
+	Followed time.Time `json:"followed"`
+	Language string    `json:"language,omitempty"`
+	Muted    []string  `json:"muted,omitempty"` // notification kinds turned off
+}
+
+// users holds the preferences of the bot's followers.
+var users = &userBook{Users: map[string]*userPrefs{}}
+
+type userBook struct {
+	mu    sync.Mutex
+	Users map[string]*userPrefs `json:"users"`
+}
+
+func (b *userBook) load() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := db.load("users", b); err != nil {
+		log.Print(err)
+	}
+}
+
+func (b *userBook) save() {
+	if err := db.save("users", b); err != nil {
+		log.Print(err)
+	}
+}
+
+func (b *userBook) get(userID string) userPrefs {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p := b.Users[userID]; p != nil {
+		return *p
+	}
+	return userPrefs{}
+}
+
+// update changes the preferences of userID with fn and saves them.
+func (b *userBook) update(userID string, fn func(p *userPrefs)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.Users[userID]
+	if p == nil {
+		p = &userPrefs{Followed: time.Now()}
+		b.Users[userID] = p
+	}
+	fn(p)
+	b.save()
+}
+
+// forget drops userID after they blocked the bot.
+func (b *userBook) forget(userID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Users[userID] == nil {
+		return
+	}
+	delete(b.Users, userID)
+	b.save()
+}
+
+// userLanguage is the language userID chose, or that of their channel.
+func userLanguage(userID string) string {
+	if lang := users.get(userID).Language; lang != "" {
+		return lang
+	}
+	if lang := channelFor(userID).Language; lang != "" {
+		return lang
+	}
+	return "en"
+}
+
+var notifications []string
+
+// registerNotification adds a kind of message the bot pushes to users on its
+// own, which they can mute. Its description is the text "notify.<name>".
+func registerNotification(name string) {
+	notifications = append(notifications, name)
+	sort.Strings(notifications)
+}
+
+// notify pushes messages of kind to userID unless they muted it.
+func notify(userID, kind string, messages ...linebot.SendingMessage) error {
+	for _, muted := range users.get(userID).Muted {
+		if muted == kind {
+			return nil
+		}
+	}
+	return pushMessage(userID, messages...)
+}
+
+// quickReplies turns label, command pairs into quick reply buttons.
+func quickReplies(pairs ...string) *linebot.QuickReplyItems {
+	var actions []linebot.QuickReplyAction
+	for i := 0; i+1 < len(pairs); i += 2 {
+		actions = append(actions, sendAction(pairs[i], pairs[i+1]))
+	}
+	return quickReplyItems(actions...)
+}
+
+// privateHelp lists what users can do in a one-on-one chat, after intro.
+func privateHelp(lang, intro string) linebot.SendingMessage {
+	text := tr(lang, "help.private")
+	if intro != "" {
+		text = intro + "\n\n" + text
+	}
+	return linebot.NewTextMessage(text).WithQuickReplies(quickReplies(
+		tr(lang, "button.mygroups"), "/mygroups",
+		tr(lang, "button.settings"), "/settings",
+		tr(lang, "button.help"), "/help",
+	))
+}
+
+// welcome greets a new follower.
+func welcome(api botAPI, event *linebot.Event) {
+	userID := event.Source.UserID
+	// Whoever follows again is a friend now, whatever was cached.
+	profiles.forget(userID, userID)
+	users.update(userID, func(p *userPrefs) { p.Followed = time.Now() })
+	lang := userLanguage(userID)
+	greeting := tr(lang, "welcome.noname")
+	if profile, err := api.GetProfile(userID); err == nil {
+		greeting = tr(lang, "welcome", profile.DisplayName)
+	}
+	messages := []linebot.SendingMessage{
+		linebot.NewTextMessage(greeting),
+		linebot.NewTextMessage(tr(lang, "welcome.groups")),
+		privateHelp(lang, ""),
+	}
+	if err := api.ReplyMessage(event.ReplyToken, messages...); err != nil {
+		log.Print(err)
+	}
+}
+
+// unfollowed forgets what was kept for a user who blocked the bot.
+func unfollowed(userID string) {
+	users.forget(userID)
+	forgetChat(userID)
+	locations.forgetChat(userID)
+}
+
+// replyPrivately answers text in a one-on-one chat that is no command.
+func replyPrivately(api botAPI, event *linebot.Event) {
+	lang := userLanguage(event.Source.UserID)
+	if err := api.ReplyMessage(event.ReplyToken, privateHelp(lang, tr(lang, "help.unknown"))); err != nil {
+		log.Print(err)
+	}
+}
+
+// myGroupsCommand lists the groups and rooms where the bot has seen the user.
+func myGroupsCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	userID := event.Source.UserID
+	lang := userLanguage(userID)
+	if event.Source.Type != linebot.EventSourceTypeUser {
+		return textReplyf("%s", tr(lang, "private.only"))
+	}
+	var lines []string
+	for _, c := range chats.list() {
+		seen := false
+		for _, id := range members.active(c.ID, 0) {
+			seen = seen || id == userID
+		}
+		if !seen {
+			continue
+		}
+		name := "Room " + truncate(c.ID, 10)
+		if c.Type == "group" {
+			if summary, err := clientFor(c.ID).GetGroupSummary(c.ID); err == nil {
+				name = summary.GroupName
+			} else {
+				log.Print(err)
+			}
+		}
+		lines = append(lines, "• "+name)
+	}
+	if len(lines) == 0 {
+		return textReplyf("%s", tr(lang, "mygroups.none"))
+	}
+	return textReplyf("%s", tr(lang, "mygroups", strings.Join(lines, "\n")))
+}
+
+// settingsCommand shows and changes the preferences of a user:
+// /settings [language <code> | mute <kind> | unmute <kind>]
+func settingsCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	userID := event.Source.UserID
+	lang := userLanguage(userID)
+	if event.Source.Type != linebot.EventSourceTypeUser {
+		return textReplyf("%s", tr(lang, "private.only"))
+	}
+	if len(args) == 2 {
+		value := strings.ToLower(args[1])
+		switch strings.ToLower(args[0]) {
+		case "language":
+			for _, l := range languages() {
+				if l == value {
+					users.update(userID, func(p *userPrefs) { p.Language = value })
+					return settingsReply(userID, tr(value, "settings.saved"))
+				}
+			}
+		case "mute", "unmute":
+			for _, kind := range notifications {
+				if kind == value {
+					mute := strings.EqualFold(args[0], "mute")
+					users.update(userID, func(p *userPrefs) { p.Muted = setMember(p.Muted, kind, mute) })
+					return settingsReply(userID, tr(lang, "settings.saved"))
+				}
+			}
+		}
+	}
+	if len(args) > 0 {
+		return textReplyf("%s", tr(lang, "settings.usage", strings.Join(languages(), "|")))
+	}
+	return settingsReply(userID, "")
+}
+
+// settingsReply shows the preferences of userID, with buttons to change
+// them.
+func settingsReply(userID, intro string) []linebot.SendingMessage {
+	prefs := users.get(userID)
+	lang := userLanguage(userID)
+	var lines, buttons []string
+	for _, l := range languages() {
+		if l != lang {
+			buttons = append(buttons, tr(lang, "button.language", l), "/settings language "+l)
+		}
+	}
+	for _, kind := range notifications {
+		about := tr(lang, "notify."+kind)
+		if hasString(prefs.Muted, kind) {
+			lines = append(lines, tr(lang, "notify.off", about, kind))
+			buttons = append(buttons, tr(lang, "button.unmute", kind), "/settings unmute "+kind)
+		} else {
+			lines = append(lines, tr(lang, "notify.on", about, kind))
+			buttons = append(buttons, tr(lang, "button.mute", kind), "/settings mute "+kind)
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, tr(lang, "notify.none"))
+	}
+	text := tr(lang, "settings", lang, strings.Join(lines, "\n"))
+	if intro != "" {
+		text = intro + "\n\n" + text
+	}
+	return []linebot.SendingMessage{linebot.NewTextMessage(text).WithQuickReplies(quickReplies(buttons...))}
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setMember adds s to list or takes it out.
+func setMember(list []string, s string, in bool) []string {
+	var out []string
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	if in {
+		out = append(out, s)
+		sort.Strings(out)
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestPrivateCommands(t *testing.T) {
+	f := useFake(t)
+	chats.Chats = map[string]*chatInfo{}
+	defer func() {
+		chats.Chats = map[string]*chatInfo{}
+		users.forget("U1")
+		members.forgetChat("G1")
+	}()
+	chats.seen(defaultChannel, inGroup)
+	members.touch(inGroup)
+
+	steps := []struct {
+		src  *linebot.EventSource
+		text string
+		want []string
+	}{
+		{inGroup, "/mygroups", []string{"reply T: Ask me that in a one-on-one chat."}},
+		{inChat, "/mygroups", []string{"group summary G1", "reply T: We are both in:\n• Friends"}},
+		{inChat, "/settings", []string{"reply T: Language: en\nNotifications:\n✅ Broadcast delivery reports (reports)"}},
+		{inChat, "/settings mute reports", []string{"reply T: Saved.\n\nLanguage: en\nNotifications:\n🔕 Broadcast"}},
+		{inChat, "/settings language xx", []string{"reply T: Usage: /settings"}},
+		{inChat, "/settings language fa", []string{"reply T: ذخیره شد."}},
+		{inChat, "/help", []string{`"altText":"دستورها: /flip /help /mygroups /pick /roll /settings"`}},
+	}
+	for _, s := range steps {
+		f.calls = nil
+		if !dispatchCommand(f, textEvent(s.src, s.text), s.text) {
+			t.Fatalf("%s: not a command", s.text)
+		}
+		checkCalls(t, f.Calls(), s.want)
+	}
+
+	f.calls = nil
+	notify("U1", "reports", linebot.NewTextMessage("done"))
+	notify("U1", "other", linebot.NewTextMessage("news"))
+	checkCalls(t, f.Calls(), []string{"push U1: news"})
+
+	handleEvent(f, &linebot.Event{Type: linebot.EventTypeUnfollow, Source: inChat})
+	if userLanguage("U1") != "en" {
+		t.Error("preferences kept after unfollowing")
+	}
+}
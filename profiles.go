@@ -0,0 +1,222 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+var (
+	profileTTL     = 24 * time.Hour
+	profileGoneTTL = time.Hour // for members who left or were not found
+	profileKeep    = 30 * 24 * time.Hour
+)
+
+var errNoProfile = errors.New("profile not found")
+
+// profiles caches member profiles by chat and user, so that names need not
+// be looked up for every message and are there after a restart.
+var profiles = &profileCache{Entries: map[string]profileEntry{}}
+
+// profileEntry is a cached profile, or a nil one for a user who is not in
+// the chat.
+type profileEntry struct {
+	Profile *linebot.UserProfileResponse `json:"profile,omitempty"`
+	Fetched time.Time                    `json:"fetched"`
+}
+
+func (e profileEntry) fresh(now time.Time) bool {
+	if e.Profile == nil {
+		return now.Sub(e.Fetched) < profileGoneTTL
+	}
+	return now.Sub(e.Fetched) < profileTTL
+}
+
+// profileCall is a lookup in flight that others wait for.
+type profileCall struct {
+	done    chan struct{}
+	profile *linebot.UserProfileResponse
+	err     error
+}
+
+type profileCache struct {
+	mu      sync.Mutex
+	saved   time.Time
+	calls   map[string]*profileCall
+	Entries map[string]profileEntry `json:"entries"` // by chat and user ID
+}
+
+func profileKey(id, userID string) string {
+	return id + " " + userID
+}
+
+func (p *profileCache) load() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := db.load("profiles", p); err != nil {
+		log.Print(err)
+	}
+}
+
+// save writes the cache out, dropping what is too old to be of use. Unless
+// force is set it does so at most once a minute. p.mu must be held.
+func (p *profileCache) save(force bool) {
+	if !force && time.Since(p.saved) < time.Minute {
+		return
+	}
+	for key, e := range p.Entries {
+		if time.Since(e.Fetched) > profileKeep {
+			delete(p.Entries, key)
+		}
+	}
+	p.saved = time.Now()
+	if err := db.save("profiles", p); err != nil {
+		log.Print(err)
+	}
+}
+
+// get returns the profile of userID in chat id, calling fetch if it is not
+// cached or has expired. Concurrent lookups of the same profile share one
+// call. If LINE fails, an expired profile is better than none.
+func (p *profileCache) get(id, userID string, fetch func() (*linebot.UserProfileResponse, error)) (*linebot.UserProfileResponse, error) {
+	key := profileKey(id, userID)
+	p.mu.Lock()
+	e, cached := p.Entries[key]
+	if cached && e.fresh(time.Now()) {
+		p.mu.Unlock()
+		return e.copy()
+	}
+	if c := p.calls[key]; c != nil {
+		p.mu.Unlock()
+		<-c.done
+		return c.result()
+	}
+	c := &profileCall{done: make(chan struct{})}
+	if p.calls == nil {
+		p.calls = map[string]*profileCall{}
+	}
+	p.calls[key] = c
+	p.mu.Unlock()
+
+	c.profile, c.err = fetch()
+	var apiErr *linebot.APIError
+	p.mu.Lock()
+	switch {
+	case c.err == nil:
+		p.Entries[key] = profileEntry{Profile: c.profile, Fetched: time.Now()}
+		p.save(!cached)
+	case errors.As(c.err, &apiErr) && apiErr.Code == http.StatusNotFound:
+		p.Entries[key] = profileEntry{Fetched: time.Now()}
+		p.save(false)
+	case cached && e.Profile != nil:
+		log.Printf("Using an old profile of %s: %v", userID, c.err)
+		c.profile, c.err = e.Profile, nil
+	}
+	delete(p.calls, key)
+	p.mu.Unlock()
+	close(c.done)
+	return c.result()
+}
+
+func (e profileEntry) copy() (*linebot.UserProfileResponse, error) {
+	if e.Profile == nil {
+		return nil, errNoProfile
+	}
+	profile := *e.Profile
+	return &profile, nil
+}
+
+func (c *profileCall) result() (*linebot.UserProfileResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	profile := *c.profile
+	return &profile, nil
+}
+
+// name is the cached display name of userID in chat id, however old, or ""
+// if there is none. It never asks LINE.
+func (p *profileCache) name(id, userID string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e := p.Entries[profileKey(id, userID)]; e.Profile != nil {
+		return e.Profile.DisplayName
+	}
+	return ""
+}
+
+// gone remembers that userID left chat id.
+func (p *profileCache) gone(id, userID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Entries[profileKey(id, userID)] = profileEntry{Fetched: time.Now()}
+	p.save(true)
+}
+
+// forget drops the profile of userID in chat id, e.g. when they join again.
+func (p *profileCache) forget(id, userID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.Entries[profileKey(id, userID)]; !ok {
+		return
+	}
+	delete(p.Entries, profileKey(id, userID))
+	p.save(true)
+}
+
+// forgetChat drops the profiles of chat id.
+func (p *profileCache) forgetChat(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prefix := id + " "
+	found := false
+	for key := range p.Entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(p.Entries, key)
+			found = true
+		}
+	}
+	if found {
+		p.save(true)
+	}
+}
+
+// cachedAPI is a botAPI that answers profile lookups from profiles.
+type cachedAPI struct {
+	botAPI
+}
+
+func (a cachedAPI) GetProfile(userID string) (*linebot.UserProfileResponse, error) {
+	return profiles.get(userID, userID, func() (*linebot.UserProfileResponse, error) {
+		return a.botAPI.GetProfile(userID)
+	})
+}
+
+func (a cachedAPI) GetGroupMemberProfile(groupID, userID string) (*linebot.UserProfileResponse, error) {
+	return profiles.get(groupID, userID, func() (*linebot.UserProfileResponse, error) {
+		return a.botAPI.GetGroupMemberProfile(groupID, userID)
+	})
+}
+
+func (a cachedAPI) GetRoomMemberProfile(roomID, userID string) (*linebot.UserProfileResponse, error) {
+	return profiles.get(roomID, userID, func() (*linebot.UserProfileResponse, error) {
+		return a.botAPI.GetRoomMemberProfile(roomID, userID)
+	})
+}
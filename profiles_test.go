@@ -0,0 +1,126 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestProfileCache(t *testing.T) {
+	f := useFake(t)
+	api := cachedAPI{f}
+	profiles.Entries = map[string]profileEntry{}
+	defer func() { profiles.Entries = map[string]profileEntry{} }()
+
+	lookup := func(want string, calls ...string) {
+		t.Helper()
+		f.calls = nil
+		name := ""
+		if profile, err := api.GetGroupMemberProfile("G1", "U1"); err == nil {
+			name = profile.DisplayName
+		}
+		if name != want {
+			t.Errorf("got name %q, want %q", name, want)
+		}
+		checkCalls(t, f.Calls(), calls)
+	}
+	lookup("Alice", "group profile G1 U1")
+	lookup("Alice")
+
+	// A name change shows once the cached profile expires.
+	f.profiles["U1"] = &linebot.UserProfileResponse{UserID: "U1", DisplayName: "Alicia"}
+	lookup("Alice")
+	profiles.Entries[profileKey("G1", "U1")] = profileEntry{
+		Profile: &linebot.UserProfileResponse{UserID: "U1", DisplayName: "Alice"},
+		Fetched: time.Now().Add(-profileTTL),
+	}
+	lookup("Alicia", "group profile G1 U1")
+
+	// While LINE fails an expired profile is still used.
+	profiles.Entries[profileKey("G1", "U1")] = profileEntry{Profile: f.profiles["U1"], Fetched: time.Now().Add(-profileTTL)}
+	f.failing["GetGroupMemberProfile"] = true
+	lookup("Alicia", "group profile G1 U1")
+	delete(f.failing, "GetGroupMemberProfile")
+
+	handleEvent(api, &linebot.Event{Type: linebot.EventTypeMemberLeft, Source: inGroup, Members: []*linebot.EventSource{{UserID: "U1"}}})
+	lookup("")
+	handleEvent(api, &linebot.Event{Type: linebot.EventTypeMemberJoined, ReplyToken: "T", Source: inGroup, Members: []*linebot.EventSource{{UserID: "U1"}}})
+	lookup("Alicia", "group profile G1 U1")
+
+	saved := &profileCache{Entries: map[string]profileEntry{}}
+	profiles.mu.Lock()
+	profiles.save(true)
+	profiles.mu.Unlock()
+	saved.load()
+	if e := saved.Entries[profileKey("G1", "U1")]; e.Profile == nil || e.Profile.DisplayName != "Alicia" {
+		t.Errorf("after a restart the profile is %+v", e)
+	}
+
+	forgetChat("G1")
+	lookup("Alicia", "group profile G1 U1")
+}
+
+func TestProfileNotFound(t *testing.T) {
+	defer func() { profiles.Entries = map[string]profileEntry{} }()
+	var calls int
+	fetch := func() (*linebot.UserProfileResponse, error) {
+		calls++
+		return nil, &linebot.APIError{Code: 404}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := profiles.get("G9", "U9", fetch); err == nil {
+			t.Error("found a missing profile")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("looked up a missing profile %d times", calls)
+	}
+}
+
+func TestProfileLookupsAreShared(t *testing.T) {
+	defer func() { profiles.Entries = map[string]profileEntry{} }()
+	var calls int32
+	release := make(chan struct{})
+	fetch := func() (*linebot.UserProfileResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &linebot.UserProfileResponse{UserID: "U8", DisplayName: "Bob"}, nil
+	}
+	var wg sync.WaitGroup
+	names := make([]string, 5)
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if profile, err := profiles.get("G8", "U8", fetch); err == nil {
+				names[i] = profile.DisplayName
+			}
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("%d lookups for one profile", calls)
+	}
+	for i, name := range names {
+		if name != "Bob" {
+			t.Errorf("lookup %d got %q", i, name)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	// maxQuickReplies is the most buttons LINE shows under a message.
+	maxQuickReplies = 13
+	// maxActionText is the longest text a message action may send.
+	maxActionText = 300
+)
+
+// suggestionFunc returns the quick replies that fit after a command's reply,
+// given the same arguments as the command.
+type suggestionFunc func(event *linebot.Event, args []string) []linebot.QuickReplyAction
+
+var suggestions = map[string]suggestionFunc{}
+
+// registerSuggestions offers the actions of fn as quick replies under the
+// replies of /name, unless the command set quick replies itself.
+func registerSuggestions(name string, fn suggestionFunc) {
+	suggestions[name] = fn
+}
+
+// quickReplyItems makes buttons of actions, keeping the first 13. Nil
+// actions are skipped.
+func quickReplyItems(actions ...linebot.QuickReplyAction) *linebot.QuickReplyItems {
+	items := linebot.NewQuickReplyItems()
+	for _, action := range actions {
+		if action != nil && len(items.Items) < maxQuickReplies {
+			items.Items = append(items.Items, linebot.NewQuickReplyButton("", action))
+		}
+	}
+	if len(items.Items) == 0 {
+		return nil
+	}
+	return items
+}
+
+// suggest attaches actions as quick replies to the last of messages, the
+// only one under which LINE shows them. It works for any kind of message.
+func suggest(messages []linebot.SendingMessage, actions ...linebot.QuickReplyAction) []linebot.SendingMessage {
+	items := quickReplyItems(actions...)
+	if len(messages) == 0 || items == nil {
+		return messages
+	}
+	last := len(messages) - 1
+	messages[last] = messages[last].WithQuickReplies(items)
+	return messages
+}
+
+// hasQuickReplies tells whether m carries quick replies already. The SDK
+// keeps them unexported, so this looks at the JSON sent to LINE.
+func hasQuickReplies(m linebot.SendingMessage) bool {
+	b, err := json.Marshal(m)
+	return err == nil && bytes.Contains(b, []byte(`"quickReply":`))
+}
+
+// commandText is what the user sent to run a command: a text message or
+// the data of a rich menu postback.
+func commandText(event *linebot.Event) string {
+	if m, ok := event.Message.(*linebot.TextMessage); ok {
+		return strings.TrimSpace(m.Text)
+	}
+	if event.Postback != nil {
+		return event.Postback.Data
+	}
+	return ""
+}
+
+// sendAction sends text when tapped, or is nil if text is too long.
+func sendAction(label, text string) linebot.QuickReplyAction {
+	if text == "" || utf8.RuneCountInString(text) > maxActionText {
+		return nil
+	}
+	return linebot.NewMessageAction(quickReplyLabel(label), text)
+}
+
+// againAction runs the command of event once more, with a fresh seed.
+func againAction(label string, event *linebot.Event) linebot.QuickReplyAction {
+	fields := strings.Fields(commandText(event))
+	if n := len(fields); n > 1 && strings.HasPrefix(fields[n-1], "#") {
+		fields = fields[:n-1]
+	}
+	return sendAction(label, strings.Join(fields, " "))
+}
+
+// helpAction asks for /help in the language of the chat of event.
+func helpAction(event *linebot.Event) linebot.QuickReplyAction {
+	return sendAction(tr(chatLanguage(event.Source), "button.help"), "/help")
+}
+
+// chatLanguage is the language of the chat of src: the user's own in a
+// one-on-one chat, the group's otherwise.
+func chatLanguage(src *linebot.EventSource) string {
+	if src.Type == linebot.EventSourceTypeUser {
+		return userLanguage(src.UserID)
+	}
+	c, _ := chats.get(sourceID(src))
+	if lang := c.language(); lang != "" {
+		return lang
+	}
+	if lang := channelFor(sourceID(src)).Language; lang != "" {
+		return lang
+	}
+	return "en"
+}
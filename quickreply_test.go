@@ -0,0 +1,122 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// quickReplyTexts returns what the quick replies of m send, one entry per
+// button: the text of message actions, otherwise the action type.
+func quickReplyTexts(t *testing.T, m linebot.SendingMessage) []string {
+	t.Helper()
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		QuickReply struct {
+			Items []struct {
+				Action struct{ Type, Text string }
+			}
+		}
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, item := range v.QuickReply.Items {
+		if item.Action.Text != "" {
+			texts = append(texts, item.Action.Text)
+		} else {
+			texts = append(texts, item.Action.Type)
+		}
+	}
+	return texts
+}
+
+func TestSuggest(t *testing.T) {
+	var many []linebot.QuickReplyAction
+	for i := 0; i < 20; i++ {
+		many = append(many, sendAction("n", fmt.Sprint(i)))
+	}
+	flex := linebot.NewFlexMessage("alt", &linebot.BubbleContainer{Type: linebot.FlexContainerTypeBubble})
+	tests := []struct {
+		name     string
+		messages []linebot.SendingMessage
+		actions  []linebot.QuickReplyAction
+		want     int
+	}{
+		{"text", textReplyf("hi"), []linebot.QuickReplyAction{sendAction("Again", "/roll")}, 1},
+		{"image", []linebot.SendingMessage{linebot.NewImageMessage("https://example.com/a.jpg", "https://example.com/a.jpg")}, []linebot.QuickReplyAction{linebot.NewLocationAction("Here")}, 1},
+		{"flex", []linebot.SendingMessage{flex}, []linebot.QuickReplyAction{linebot.NewDatetimePickerAction("When", "a=when", "date", "", "", "")}, 1},
+		{"trimmed", textReplyf("hi"), many, maxQuickReplies},
+		{"nil skipped", textReplyf("hi"), []linebot.QuickReplyAction{nil, sendAction("Help", "/help"), sendAction("long", string(make([]byte, 301)))}, 1},
+		{"nothing", textReplyf("hi"), nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := suggest(tt.messages, tt.actions...)
+			if n := len(quickReplyTexts(t, got[len(got)-1])); n != tt.want {
+				t.Errorf("%d quick replies, want %d", n, tt.want)
+			}
+			if hasQuickReplies(got[0]) != (tt.want > 0) {
+				t.Errorf("hasQuickReplies = %v", !(tt.want > 0))
+			}
+		})
+	}
+}
+
+func TestCommandSuggestions(t *testing.T) {
+	f := useFake(t)
+	adminIDs["U1"] = true
+	chats.Chats = map[string]*chatInfo{}
+	defer func() {
+		delete(adminIDs, "U1")
+		chats.Chats = map[string]*chatInfo{}
+	}()
+	chats.seen(defaultChannel, inGroup)
+	tests := []struct {
+		src  *linebot.EventSource
+		text string
+		want []string
+	}{
+		{inGroup, "/roll 2d6 #42", []string{"/roll 2d6", "/help"}},
+		{inGroup, "/werewolf new", []string{"/join", "/werewolf start"}},
+		{inGroup, "/location on", []string{"location"}},
+		{inGroup, "/location off", nil},
+		{inChat, "/broadcast dry tag:x lang:en Down\ntonight", nil}, // nothing matches, no dry run to send
+		{inChat, "/broadcast dry Down\ntonight", []string{"/broadcast Down\ntonight"}},
+		{inChat, "/settings", []string{"/settings language fa", "/settings mute reports"}}, // its own
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			f.calls = nil
+			dispatchCommand(f, textEvent(tt.src, tt.text), tt.text)
+			if len(f.lastReply) == 0 {
+				t.Fatalf("no reply: %v", f.Calls())
+			}
+			got := quickReplyTexts(t, f.lastReply[len(f.lastReply)-1])
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("quick replies %q, want %q", got, tt.want)
+			}
+		})
+	}
+	werewolves.Lock()
+	delete(werewolves.games, "G1")
+	werewolves.Unlock()
+}
@@ -0,0 +1,306 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	quizRoundTime   = 20 * time.Second
+	quizRounds      = 5
+	quizMaxRounds   = 20
+	quizPoints      = 100
+	quizSpeedPoints = 50
+)
+
+// quizBankPath is the JSON question bank, overridden by QuizBank.
+var quizBankPath = "quiz.json"
+
+func init() {
+	registerCommand("quiz", quizCommand)
+	registerHelp("quiz", commandHelp{
+		Summary:   "Play a trivia quiz",
+		SummaryFa: "مسابقه‌ی پرسش و پاسخ",
+		Usage:     []string{"/quiz start", "/quiz start 5", "/quiz score", "/quiz stop"},
+		Where:     inShared,
+	})
+	registerSuggestions("quiz", func(event *linebot.Event, args []string) []linebot.QuickReplyAction {
+		return []linebot.QuickReplyAction{sendAction("🏆 Score", "/quiz score"), sendAction("New quiz", "/quiz start")}
+	})
+}
+
+// quizQuestion is one entry of the question bank. Answer indexes Choices.
+type quizQuestion struct {
+	Question string   `json:"question"`
+	Choices  []string `json:"choices"`
+	Answer   int      `json:"answer"`
+}
+
+// quizGame is a game in progress in one group or room.
+type quizGame struct {
+	source    linebot.EventSource
+	questions []quizQuestion
+	round     int
+	asked     time.Time
+	answered  map[string]bool
+	scores    map[string]int
+	timer     *time.Timer
+}
+
+var quizzes = struct {
+	sync.Mutex
+	games map[string]*quizGame
+}{games: map[string]*quizGame{}}
+
+// loadQuizBank reads the question bank and drops malformed questions.
+func loadQuizBank(path string) ([]quizQuestion, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var all []quizQuestion
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var bank []quizQuestion
+	for _, q := range all {
+		if q.Question != "" && len(q.Choices) >= 2 && len(q.Choices) <= 13 && q.Answer >= 0 && q.Answer < len(q.Choices) {
+			bank = append(bank, q)
+		}
+	}
+	return bank, nil
+}
+
+func quizCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	if event.Source.GroupID == "" && event.Source.RoomID == "" {
+		return textReplyf("Quizzes are played in a group or room.")
+	}
+	sub := ""
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	switch sub {
+	case "start":
+		return startQuiz(event.Source, args[1:])
+	case "stop":
+		return stopQuiz(event.Source)
+	case "score":
+		quizzes.Lock()
+		game := quizzes.games[sourceID(event.Source)]
+		if game == nil {
+			quizzes.Unlock()
+			return textReplyf("No quiz is running.")
+		}
+		standings := game.standings()
+		quizzes.Unlock()
+		return textReplyf("%s", scoreboard(event.Source, standings))
+	}
+	return textReplyf("Usage: /quiz start [rounds], /quiz score, /quiz stop")
+}
+
+func startQuiz(src *linebot.EventSource, args []string) []linebot.SendingMessage {
+	rounds := quizRounds
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > quizMaxRounds {
+			return textReplyf("Rounds must be 1-%d.", quizMaxRounds)
+		}
+		rounds = n
+	}
+	bank, err := loadQuizBank(quizBankPath)
+	if err != nil {
+		log.Print(err)
+		return textReplyf("The question bank is not available.")
+	}
+	if len(bank) == 0 {
+		return textReplyf("The question bank is empty.")
+	}
+	rand.Shuffle(len(bank), func(i, j int) { bank[i], bank[j] = bank[j], bank[i] })
+	if rounds > len(bank) {
+		rounds = len(bank)
+	}
+
+	quizzes.Lock()
+	defer quizzes.Unlock()
+	id := sourceID(src)
+	if quizzes.games[id] != nil {
+		return textReplyf("A quiz is already running here. /quiz stop ends it.")
+	}
+	game := &quizGame{source: *src, questions: bank[:rounds], scores: map[string]int{}}
+	quizzes.games[id] = game
+	return []linebot.SendingMessage{game.ask(id)}
+}
+
+func stopQuiz(src *linebot.EventSource) []linebot.SendingMessage {
+	quizzes.Lock()
+	id := sourceID(src)
+	game := quizzes.games[id]
+	if game == nil {
+		quizzes.Unlock()
+		return textReplyf("No quiz is running.")
+	}
+	game.timer.Stop()
+	delete(quizzes.games, id)
+	standings := game.standings()
+	quizzes.Unlock()
+	return textReplyf("Quiz stopped.\n%s", scoreboard(src, standings))
+}
+
+// ask opens the current round and schedules its end. The caller holds the
+// quizzes lock.
+func (g *quizGame) ask(id string) linebot.SendingMessage {
+	q := g.questions[g.round]
+	g.asked = time.Now()
+	g.answered = map[string]bool{}
+	round := g.round
+	g.timer = time.AfterFunc(quizRoundTime, func() { endQuizRound(id, g, round) })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "❓ %d/%d: %s\n", g.round+1, len(g.questions), q.Question)
+	var actions []linebot.QuickReplyAction
+	for i, choice := range q.Choices {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, choice)
+		// Buttons send the choice itself, which matchChoice reads before
+		// numbers, so that choices that are numbers cannot be mistaken.
+		actions = append(actions, sendAction(fmt.Sprintf("%d. %s", i+1, choice), choice))
+	}
+	fmt.Fprintf(&b, "%d seconds!", int(quizRoundTime/time.Second))
+	return linebot.NewTextMessage(b.String()).WithQuickReplies(quickReplyItems(actions...))
+}
+
+// quickReplyLabel shortens s to the 20 characters LINE allows in a label.
+func quickReplyLabel(s string) string {
+	return truncate(s, 20)
+}
+
+// endQuizRound reveals the answer and pushes the next question or the final
+// scoreboard. It does nothing if the game was stopped or moved on.
+func endQuizRound(id string, g *quizGame, round int) {
+	quizzes.Lock()
+	if quizzes.games[id] != g || g.round != round {
+		quizzes.Unlock()
+		return
+	}
+	q := g.questions[round]
+	reveal := linebot.NewTextMessage(fmt.Sprintf("⏰ Time's up! The answer was: %s", q.Choices[q.Answer]))
+	var next linebot.SendingMessage
+	var final []quizScore
+	if g.round++; g.round < len(g.questions) {
+		next = g.ask(id)
+	} else {
+		delete(quizzes.games, id)
+		final = g.standings()
+	}
+	quizzes.Unlock()
+
+	// Names are looked up and the push is sent without holding up answers
+	// in other chats.
+	if next == nil {
+		next = linebot.NewTextMessage("🏁 Final scores\n" + scoreboard(&g.source, final))
+	}
+	if err := clientFor(id).PushMessage(id, reveal, next); err != nil {
+		log.Print(err)
+	}
+}
+
+// answerQuiz scores text as an answer to the running round in the chat of
+// event. It reports whether the text was taken as an answer.
+func answerQuiz(event *linebot.Event, text string) bool {
+	id := sourceID(event.Source)
+	if id == event.Source.UserID {
+		return false
+	}
+	quizzes.Lock()
+	defer quizzes.Unlock()
+	game := quizzes.games[id]
+	if game == nil || game.answered[event.Source.UserID] {
+		return false
+	}
+	q := game.questions[game.round]
+	choice := matchChoice(q.Choices, text)
+	if choice < 0 {
+		return false
+	}
+	game.answered[event.Source.UserID] = true
+	if choice != q.Answer {
+		return true
+	}
+	left := quizRoundTime - time.Since(game.asked)
+	if left < 0 {
+		left = 0
+	}
+	game.scores[event.Source.UserID] += quizPoints + int(quizSpeedPoints*left/quizRoundTime)
+	return true
+}
+
+// matchChoice accepts a choice by its text or, failing that, its number, so
+// that "4" picks the choice "4" rather than the fourth one.
+func matchChoice(choices []string, text string) int {
+	text = strings.TrimSpace(text)
+	for i, choice := range choices {
+		if strings.EqualFold(choice, text) {
+			return i
+		}
+	}
+	if n, err := strconv.Atoi(text); err == nil && n >= 1 && n <= len(choices) {
+		return n - 1
+	}
+	return -1
+}
+
+// quizScore is the score of one player.
+type quizScore struct {
+	userID string
+	points int
+}
+
+// standings copies out the scores, best first. The caller holds the
+// quizzes lock.
+func (g *quizGame) standings() []quizScore {
+	scores := make([]quizScore, 0, len(g.scores))
+	for userID, points := range g.scores {
+		scores = append(scores, quizScore{userID, points})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].points != scores[j].points {
+			return scores[i].points > scores[j].points
+		}
+		return scores[i].userID < scores[j].userID
+	})
+	return scores
+}
+
+// scoreboard lists the players of the chat of src by score. It looks up
+// their names, so the caller must not hold the quizzes lock.
+func scoreboard(src *linebot.EventSource, scores []quizScore) string {
+	if len(scores) == 0 {
+		return "Nobody scored."
+	}
+	var b strings.Builder
+	for i, s := range scores {
+		fmt.Fprintf(&b, "%d. %s — %d\n", i+1, displayName(src, s.userID), s.points)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
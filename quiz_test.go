@@ -0,0 +1,88 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMatchChoice(t *testing.T) {
+	tests := []struct {
+		choices []string
+		text    string
+		want    int
+	}{
+		{[]string{"Paris", "Rome", "Oslo"}, " rome ", 1},
+		{[]string{"Paris", "Rome", "Oslo"}, "3", 2},
+		{[]string{"Paris", "Rome", "Oslo"}, "4", -1},
+		{[]string{"Paris", "Rome", "Oslo"}, "Berlin", -1},
+		{[]string{"3", "4", "5"}, "4", 1},
+		{[]string{"3", "4", "5"}, "2", 1},
+		{[]string{"1991", "3", "1989"}, "3", 1},
+		{[]string{"1991", "3", "1989"}, "1", 0},
+	}
+	for _, tt := range tests {
+		if got := matchChoice(tt.choices, tt.text); got != tt.want {
+			t.Errorf("matchChoice(%q, %q) = %d, want %d", tt.choices, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestQuizNumericChoices(t *testing.T) {
+	f := useFake(t)
+	id := sourceID(inGroup)
+	game := &quizGame{
+		source:    *inGroup,
+		questions: []quizQuestion{{Question: "When did the web start?", Choices: []string{"1991", "3", "1989"}, Answer: 2}},
+		scores:    map[string]int{},
+	}
+	quizzes.Lock()
+	quizzes.games[id] = game
+	question := game.ask(id)
+	quizzes.Unlock()
+	defer func() {
+		quizzes.Lock()
+		game.timer.Stop()
+		delete(quizzes.games, id)
+		quizzes.Unlock()
+	}()
+
+	b, err := json.Marshal(question)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"label":"1. 1991","text":"1991"`, `"label":"2. 3","text":"3"`, `"label":"3. 1989","text":"1989"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("question lacks button %s: %s", want, b)
+		}
+	}
+
+	// Pressing the third button scores, although "3" is also a choice.
+	if !answerQuiz(textEvent(inGroup, "1989"), "1989") {
+		t.Fatal("the button press was not taken as an answer")
+	}
+	quizzes.Lock()
+	standings := game.standings()
+	quizzes.Unlock()
+	if len(standings) != 1 || standings[0].points < quizPoints {
+		t.Errorf("standings are %+v", standings)
+	}
+	if got := scoreboard(inGroup, standings); !strings.HasPrefix(got, "1. Alice — ") {
+		t.Errorf("scoreboard is %q", got)
+	}
+	if len(f.Calls()) == 0 {
+		t.Error("no name was looked up")
+	}
+}
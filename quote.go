@@ -0,0 +1,255 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const maxQuoteResults = 10 // bubbles in a carousel
+
+func init() {
+	registerCommand("quote", quoteCommand)
+	registerHelp("quote", commandHelp{
+		Summary:   "Save and find what members said",
+		SummaryFa: "ذخیره و جستجوی نقل‌قول‌های اعضا",
+		Usage:     []string{"/quote", "/quote save @member", "/quote search word", "/quote @member", "/quote delete 3"},
+		Where:     inShared,
+	})
+	registerMessageHook(rememberMessage)
+	registerSuggestions("quote", func(event *linebot.Event, args []string) []linebot.QuickReplyAction {
+		return []linebot.QuickReplyAction{sendAction("Random quote", "/quote random")}
+	})
+}
+
+// quote is a saved message. Name is the author's profile name when saved.
+type quote struct {
+	ID      int       `json:"id"`
+	UserID  string    `json:"userId"`
+	Name    string    `json:"name"`
+	Text    string    `json:"text"`
+	Time    time.Time `json:"time"`
+	SavedBy string    `json:"savedBy"`
+}
+
+// quotes holds the quote book of every group and room.
+var quotes = &quoteBook{Chats: map[string][]quote{}}
+
+type quoteBook struct {
+	mu     sync.Mutex
+	NextID int                `json:"nextId"`
+	Chats  map[string][]quote `json:"chats"`
+}
+
+func (q *quoteBook) load() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := db.load("quotes", q); err != nil {
+		log.Print(err)
+	}
+}
+
+func (q *quoteBook) add(id string, qt quote) quote {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.NextID++
+	qt.ID = q.NextID
+	q.Chats[id] = append(q.Chats[id], qt)
+	if err := db.save("quotes", q); err != nil {
+		log.Print(err)
+	}
+	return qt
+}
+
+// forgetChat deletes the quotes of chat id.
+func (q *quoteBook) forgetChat(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.Chats[id]; !ok {
+		return
+	}
+	delete(q.Chats, id)
+	if err := db.save("quotes", q); err != nil {
+		log.Print(err)
+	}
+}
+
+// find returns the quotes of chat id that match keep.
+func (q *quoteBook) find(id string, keep func(quote) bool) []quote {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var found []quote
+	for _, qt := range q.Chats[id] {
+		if keep(qt) {
+			found = append(found, qt)
+		}
+	}
+	return found
+}
+
+// remove deletes quote n of chat id if allowed approves it.
+func (q *quoteBook) remove(id string, n int, allowed func(quote) bool) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	book := q.Chats[id]
+	for i, qt := range book {
+		if qt.ID != n {
+			continue
+		}
+		if !allowed(qt) {
+			return false, fmt.Errorf("only the author or an admin can delete quote #%d", n)
+		}
+		q.Chats[id] = append(book[:i], book[i+1:]...)
+		return true, db.save("quotes", q)
+	}
+	return false, nil
+}
+
+// recentMessage is the last text message in a chat, overall and per member,
+// so that /quote can save it.
+type recentMessage struct {
+	userID string
+	text   string
+	time   time.Time
+}
+
+var recent = struct {
+	sync.Mutex
+	last   map[string]recentMessage
+	byUser map[string]map[string]recentMessage
+}{last: map[string]recentMessage{}, byUser: map[string]map[string]recentMessage{}}
+
+func rememberMessage(api botAPI, event *linebot.Event) {
+	message, ok := event.Message.(*linebot.TextMessage)
+	if !ok || strings.HasPrefix(message.Text, "/") || event.Source.UserID == "" {
+		return
+	}
+	id := sourceID(event.Source)
+	m := recentMessage{userID: event.Source.UserID, text: message.Text, time: event.Timestamp}
+	recent.Lock()
+	defer recent.Unlock()
+	recent.last[id] = m
+	if recent.byUser[id] == nil {
+		recent.byUser[id] = map[string]recentMessage{}
+	}
+	recent.byUser[id][m.userID] = m
+}
+
+func quoteCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	id := sourceID(event.Source)
+	sub := ""
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	mentioned := mentions(event)
+	switch {
+	case sub == "" || sub == "save":
+		return saveQuote(event, mentioned)
+	case sub == "random":
+		found := quotes.find(id, func(quote) bool { return true })
+		if len(found) == 0 {
+			return textReplyf("The quote book is empty. Type /quote right after a message to save it.")
+		}
+		return quoteReply(found[rand.Intn(len(found)):][:1])
+	case sub == "search" && len(args) > 1:
+		word := strings.ToLower(strings.Join(args[1:], " "))
+		return quoteReply(quotes.find(id, func(qt quote) bool {
+			return strings.Contains(strings.ToLower(qt.Text), word)
+		}))
+	case sub == "delete" && len(args) > 1:
+		n, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+		if err != nil {
+			return textReplyf("Usage: /quote delete <number>")
+		}
+		ok, err := quotes.remove(id, n, func(qt quote) bool {
+			return qt.UserID == event.Source.UserID || isAdmin(event.Source)
+		})
+		switch {
+		case err != nil:
+			return textReplyf("%v.", err)
+		case !ok:
+			return textReplyf("There is no quote #%d.", n)
+		}
+		return textReplyf("Quote #%d deleted.", n)
+	case len(mentioned) > 0:
+		return quoteReply(quotes.find(id, func(qt quote) bool { return qt.UserID == mentioned[0] }))
+	}
+	return textReplyf("Usage: /quote, /quote save @member, /quote random, /quote search <word>, /quote @member, /quote delete <number>")
+}
+
+// saveQuote saves the last message in the chat, or the last message of the
+// mentioned member.
+func saveQuote(event *linebot.Event, mentioned []string) []linebot.SendingMessage {
+	id := sourceID(event.Source)
+	recent.Lock()
+	m, ok := recent.last[id]
+	if len(mentioned) > 0 {
+		m, ok = recent.byUser[id][mentioned[0]]
+	}
+	recent.Unlock()
+	if !ok {
+		return textReplyf("There is no recent message to quote.")
+	}
+	qt := quotes.add(id, quote{
+		UserID:  m.userID,
+		Name:    displayName(event.Source, m.userID),
+		Text:    m.text,
+		Time:    m.time,
+		SavedBy: event.Source.UserID,
+	})
+	return []linebot.SendingMessage{linebot.NewFlexMessage(truncate("Quote saved: "+qt.Text, 400), quoteBubble(qt))}
+}
+
+// quoteReply shows the newest matching quotes as a carousel.
+func quoteReply(found []quote) []linebot.SendingMessage {
+	if len(found) == 0 {
+		return textReplyf("No quotes found.")
+	}
+	if len(found) == 1 {
+		return []linebot.SendingMessage{linebot.NewFlexMessage(truncate(found[0].Name+": "+found[0].Text, 400), quoteBubble(found[0]))}
+	}
+	if len(found) > maxQuoteResults {
+		found = found[len(found)-maxQuoteResults:]
+	}
+	carousel := &linebot.CarouselContainer{Type: linebot.FlexContainerTypeCarousel}
+	for i := len(found) - 1; i >= 0; i-- {
+		carousel.Contents = append(carousel.Contents, quoteBubble(found[i]))
+	}
+	return []linebot.SendingMessage{linebot.NewFlexMessage(fmt.Sprintf("%d quotes", len(found)), carousel)}
+}
+
+func quoteBubble(qt quote) *linebot.BubbleContainer {
+	return &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Body: &linebot.BoxComponent{
+			Type:    linebot.FlexComponentTypeBox,
+			Layout:  linebot.FlexBoxLayoutTypeVertical,
+			Spacing: linebot.FlexComponentSpacingTypeMd,
+			Contents: []linebot.FlexComponent{
+				&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: "❝", Size: linebot.FlexTextSizeType3xl, Color: "#AAAAAA"},
+				&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: qt.Text, Wrap: true, Size: linebot.FlexTextSizeTypeLg},
+				&linebot.SeparatorComponent{Type: linebot.FlexComponentTypeSeparator, Margin: linebot.FlexComponentMarginTypeLg},
+				&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: "— " + qt.Name, Weight: linebot.FlexTextWeightTypeBold, Align: linebot.FlexComponentAlignTypeEnd},
+				&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: fmt.Sprintf("%s · #%d", qt.Time.Format("2006-01-02"), qt.ID), Size: linebot.FlexTextSizeTypeXs, Color: "#999999", Align: linebot.FlexComponentAlignTypeEnd},
+			},
+		},
+	}
+}
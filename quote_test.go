@@ -0,0 +1,80 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestQuoteDelete(t *testing.T) {
+	f := useFake(t)
+	f.profiles["U2"] = &linebot.UserProfileResponse{UserID: "U2", DisplayName: "Bob"}
+	f.profiles["U3"] = &linebot.UserProfileResponse{UserID: "U3", DisplayName: "Carol"}
+	quotes.Chats = map[string][]quote{}
+	defer func() {
+		quotes.Chats = map[string][]quote{}
+		admins.set("G1", "U1", false)
+	}()
+	bob := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: "U2"}
+	carol := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: "U3"}
+	run := func(src *linebot.EventSource, text string) string {
+		t.Helper()
+		f.calls = nil
+		handleEvent(f, textEvent(src, text))
+		calls := f.Calls()
+		if len(calls) == 0 {
+			t.Fatalf("%s: no reply", text)
+		}
+		return calls[len(calls)-1]
+	}
+	// Bob says something and Carol saves it.
+	save := func() int {
+		t.Helper()
+		handleEvent(f, textEvent(bob, "I never lose at werewolf"))
+		run(carol, "/quote")
+		found := quotes.find("G1", func(quote) bool { return true })
+		if len(found) == 0 || found[len(found)-1].UserID != "U2" || found[len(found)-1].SavedBy != "U3" {
+			t.Fatalf("quote not saved: %+v", found)
+		}
+		return found[len(found)-1].ID
+	}
+
+	n := save()
+	tests := []struct {
+		src  *linebot.EventSource
+		want string
+	}{
+		{carol, "only the author or an admin can delete quote"}, // saving it is not enough
+		{inGroup, "only the author or an admin can delete quote"},
+		{bob, fmt.Sprintf("Quote #%d deleted.", n)},
+		{bob, fmt.Sprintf("There is no quote #%d.", n)},
+	}
+	for _, tt := range tests {
+		if got := run(tt.src, fmt.Sprintf("/quote delete #%d", n)); !strings.Contains(got, tt.want) {
+			t.Errorf("%s deleting: got %q, want %q", tt.src.UserID, got, tt.want)
+		}
+	}
+
+	n = save()
+	admins.set("G1", "U1", true)
+	if got := run(inGroup, fmt.Sprintf("/quote delete %d", n)); !strings.Contains(got, "deleted") {
+		t.Errorf("an admin deleting: got %q", got)
+	}
+	if got := run(inGroup, "/quote delete last"); !strings.Contains(got, "Usage: /quote delete <number>") {
+		t.Errorf("bad number: got %q", got)
+	}
+}
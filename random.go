@@ -0,0 +1,291 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Every draw is made from a seeded generator and the seed is printed with
+// the result. Repeating a command with "#<seed>" as its last argument over
+// the same candidates gives the same result, so anyone can check a draw.
+// Such a repeat is labelled as a replay, so that a seed tried out in
+// private cannot pass for a fresh draw.
+
+const (
+	maxDice     = 100
+	maxDieSides = 1000
+	activeSpan  = 30 * 24 * time.Hour
+)
+
+func init() {
+	registerCommand("roll", rollCommand)
+	registerCommand("flip", flipCommand)
+	registerCommand("pick", pickCommand)
+	registerCommand("draw", drawCommand)
+	registerCommand("teams", teamsCommand)
+	registerCommand("optout", optOutCommand)
+	registerCommand("optin", optInCommand)
+	registerHelp("roll", commandHelp{
+		Summary:   "Roll dice",
+		SummaryFa: "انداختن تاس",
+		Usage:     []string{"/roll", "/roll 2d6", "/roll d20"},
+		Where:     inAnyChats,
+	})
+	registerHelp("flip", commandHelp{
+		Summary:   "Flip a coin",
+		SummaryFa: "انداختن سکه",
+		Usage:     []string{"/flip"},
+		Where:     inAnyChats,
+	})
+	registerHelp("pick", commandHelp{
+		Summary:   "Pick one of the choices",
+		SummaryFa: "انتخاب تصادفی یکی از گزینه‌ها",
+		Usage:     []string{"/pick pizza sushi kebab"},
+		Where:     inAnyChats,
+	})
+	registerHelp("draw", commandHelp{
+		Summary:   "Draw winners among the members",
+		SummaryFa: "قرعه‌کشی بین اعضا",
+		Usage:     []string{"/draw", "/draw 3"},
+		Where:     inShared,
+	})
+	registerHelp("teams", commandHelp{
+		Summary:   "Split the active members into teams",
+		SummaryFa: "تقسیم اعضای فعال به چند تیم",
+		Usage:     []string{"/teams", "/teams 3"},
+		Where:     inShared,
+	})
+	registerHelp("optout", commandHelp{
+		Summary:   "Stop being drawn or put in teams here",
+		SummaryFa: "کنار گذاشتن شما از قرعه‌کشی و تیم‌ها",
+		Usage:     []string{"/optout"},
+		Where:     inShared,
+	})
+	registerHelp("optin", commandHelp{
+		Summary:   "Be drawn and put in teams again",
+		SummaryFa: "بازگشت شما به قرعه‌کشی و تیم‌ها",
+		Usage:     []string{"/optin"},
+		Where:     inShared,
+	})
+	for _, name := range []string{"roll", "flip", "pick", "draw", "teams"} {
+		registerSuggestions(name, againSuggestions)
+	}
+}
+
+// againSuggestions offers to run a random command again.
+func againSuggestions(event *linebot.Event, args []string) []linebot.QuickReplyAction {
+	return []linebot.QuickReplyAction{againAction("🔁 Again", event), helpAction(event)}
+}
+
+// optOuts holds the users of each chat who do not want to be drawn.
+var optOuts = &optOutList{Users: map[string]map[string]bool{}}
+
+type optOutList struct {
+	mu    sync.Mutex
+	Users map[string]map[string]bool `json:"users"`
+}
+
+func (o *optOutList) load() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := db.load("optout", o); err != nil {
+		log.Print(err)
+	}
+}
+
+func (o *optOutList) set(id, userID string, out bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.Users[id] == nil {
+		o.Users[id] = map[string]bool{}
+	}
+	if out {
+		o.Users[id][userID] = true
+	} else {
+		delete(o.Users[id], userID)
+	}
+	if err := db.save("optout", o); err != nil {
+		log.Print(err)
+	}
+}
+
+// filter removes the users of chat id who opted out.
+func (o *optOutList) filter(id string, userIDs []string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var in []string
+	for _, userID := range userIDs {
+		if !o.Users[id][userID] {
+			in = append(in, userID)
+		}
+	}
+	return in
+}
+
+// seeded takes a "#<seed>" suffix off args, or makes a fresh seed. The
+// label tells the seed to show with the result.
+func seeded(args []string) (r *rand.Rand, label string, rest []string) {
+	if n := len(args); n > 0 && strings.HasPrefix(args[n-1], "#") {
+		if seed, err := strconv.ParseInt(args[n-1][1:], 10, 64); err == nil {
+			return rand.New(rand.NewSource(seed)), fmt.Sprintf("🔁 replay of #%d, not a new draw", seed), args[:n-1]
+		}
+	}
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		log.Print(err)
+		binary.BigEndian.PutUint64(b[:], uint64(time.Now().UnixNano()))
+	}
+	seed := int64(binary.BigEndian.Uint64(b[:]) >> 1)
+	return rand.New(rand.NewSource(seed)), fmt.Sprintf("seed #%d", seed), args
+}
+
+// parseDice reads "NdM" or "dM"; an empty spec is a single six-sided die.
+func parseDice(spec string) (n, sides int, err error) {
+	if spec == "" {
+		return 1, 6, nil
+	}
+	i := strings.IndexAny(spec, "dD")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("dice must look like 2d6, not %q", spec)
+	}
+	n = 1
+	if i > 0 {
+		if n, err = strconv.Atoi(spec[:i]); err != nil {
+			return 0, 0, fmt.Errorf("bad number of dice %q", spec[:i])
+		}
+	}
+	if sides, err = strconv.Atoi(spec[i+1:]); err != nil {
+		return 0, 0, fmt.Errorf("bad number of sides %q", spec[i+1:])
+	}
+	if n < 1 || n > maxDice || sides < 2 || sides > maxDieSides {
+		return 0, 0, fmt.Errorf("use 1-%d dice with 2-%d sides", maxDice, maxDieSides)
+	}
+	return n, sides, nil
+}
+
+func rollCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	r, label, args := seeded(args)
+	spec := ""
+	if len(args) > 0 {
+		spec = args[0]
+	}
+	n, sides, err := parseDice(spec)
+	if err != nil {
+		return textReplyf("🎲 %v", err)
+	}
+	rolls := make([]string, n)
+	total := 0
+	for i := range rolls {
+		v := r.Intn(sides) + 1
+		total += v
+		rolls[i] = strconv.Itoa(v)
+	}
+	return textReplyf("🎲 %dd%d: %s = %d\n%s", n, sides, strings.Join(rolls, " + "), total, label)
+}
+
+func flipCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	r, label, _ := seeded(args)
+	side := "Heads"
+	if r.Intn(2) == 1 {
+		side = "Tails"
+	}
+	return textReplyf("🪙 %s\n%s", side, label)
+}
+
+func pickCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	r, label, args := seeded(args)
+	if len(args) < 2 {
+		return textReplyf("Usage: /pick <choice> <choice> ...")
+	}
+	return textReplyf("👉 %s\n%s", args[r.Intn(len(args))], label)
+}
+
+func drawCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	if event.Source.GroupID == "" && event.Source.RoomID == "" {
+		return textReplyf("/draw only works in a group or room.")
+	}
+	r, label, args := seeded(args)
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return textReplyf("Usage: /draw <number of winners>")
+		}
+	}
+	candidates := optOuts.filter(sourceID(event.Source), memberIDs(event.Source))
+	if n > len(candidates) {
+		return textReplyf("Only %d members can be drawn.", len(candidates))
+	}
+	r.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	var b strings.Builder
+	b.WriteString("🎉 Winners:\n")
+	for i, userID := range candidates[:n] {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, displayName(event.Source, userID))
+	}
+	fmt.Fprintf(&b, "%s · %d candidates", label, len(candidates))
+	return textReplyf("%s", b.String())
+}
+
+func teamsCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	if event.Source.GroupID == "" && event.Source.RoomID == "" {
+		return textReplyf("/teams only works in a group or room.")
+	}
+	r, label, args := seeded(args)
+	n := 2
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 2 {
+			return textReplyf("Usage: /teams <number of teams>")
+		}
+	}
+	players := optOuts.filter(sourceID(event.Source), members.active(sourceID(event.Source), activeSpan))
+	if n > len(players) {
+		return textReplyf("Only %d active members to split.", len(players))
+	}
+	r.Shuffle(len(players), func(i, j int) {
+		players[i], players[j] = players[j], players[i]
+	})
+	teams := make([][]string, n)
+	for i, userID := range players {
+		teams[i%n] = append(teams[i%n], displayName(event.Source, userID))
+	}
+	var b strings.Builder
+	for i, team := range teams {
+		fmt.Fprintf(&b, "Team %d: %s\n", i+1, strings.Join(team, ", "))
+	}
+	fmt.Fprintf(&b, "%s · %d players", label, len(players))
+	return textReplyf("%s", b.String())
+}
+
+func optOutCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	optOuts.set(sourceID(event.Source), event.Source.UserID, true)
+	return textReplyf("You will no longer be drawn or put in teams here.")
+}
+
+func optInCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	optOuts.set(sourceID(event.Source), event.Source.UserID, false)
+	return textReplyf("You can be drawn and put in teams again.")
+}
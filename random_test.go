@@ -0,0 +1,94 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestParseDice(t *testing.T) {
+	tests := []struct {
+		spec      string
+		n, sides  int
+		wantError bool
+	}{
+		{"", 1, 6, false},
+		{"d20", 1, 20, false},
+		{"3D6", 3, 6, false},
+		{"6", 0, 0, true},
+		{"xd6", 0, 0, true},
+		{"2d1", 0, 0, true},
+		{"0d6", 0, 0, true},
+		{fmt.Sprintf("%dd6", maxDice+1), 0, 0, true},
+	}
+	for _, tt := range tests {
+		n, sides, err := parseDice(tt.spec)
+		if (err != nil) != tt.wantError || n != tt.n || sides != tt.sides {
+			t.Errorf("parseDice(%q) = %d, %d, %v", tt.spec, n, sides, err)
+		}
+	}
+}
+
+var seedLabel = regexp.MustCompile(`seed #(\d+)`)
+
+// TestSeededReplay reruns each draw with the seed it showed and expects the
+// same result, labelled as a replay.
+func TestSeededReplay(t *testing.T) {
+	f := useFake(t)
+	members.Seen = map[string]map[string]time.Time{}
+	defer func() { members.Seen = map[string]map[string]time.Time{} }()
+	for i := 1; i <= 6; i++ {
+		userID := fmt.Sprintf("U%d", i)
+		if f.profiles[userID] == nil {
+			f.profiles[userID] = &linebot.UserProfileResponse{UserID: userID, DisplayName: "Player " + userID}
+		}
+		members.touch(&linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: userID})
+	}
+	reply := func(text string) string {
+		t.Helper()
+		f.calls = nil
+		handleEvent(f, textEvent(inGroup, text))
+		for _, call := range f.Calls() {
+			if strings.HasPrefix(call, "reply T: ") {
+				return strings.TrimPrefix(call, "reply T: ")
+			}
+		}
+		t.Fatalf("%s: no reply in %q", text, f.Calls())
+		return ""
+	}
+
+	for _, command := range []string{"/roll 5d20", "/flip", "/pick tea coffee juice water", "/draw 2", "/teams 3"} {
+		first := reply(command)
+		m := seedLabel.FindStringSubmatch(first)
+		if m == nil {
+			t.Errorf("%s shows no seed: %q", command, first)
+			continue
+		}
+		again := reply(command + " #" + m[1])
+		want := strings.Replace(first, m[0], "🔁 replay of #"+m[1]+", not a new draw", 1)
+		if again != want {
+			t.Errorf("%s #%s:\ngot  %q\nwant %q", command, m[1], again, want)
+		}
+	}
+
+	// A seed that is not a number is taken as a choice.
+	if got := reply("/pick #red #blue"); seedLabel.FindString(got) == "" || strings.Contains(got, "replay") {
+		t.Errorf("/pick #red #blue: %q", got)
+	}
+}
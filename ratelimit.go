@@ -0,0 +1,356 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Every channel's calls to LINE go through a limitedAPI. It spaces the calls
+// of each endpoint class, retries the ones LINE throttled (429) or failed
+// (5xx) with exponential backoff, and holds back calls that can wait once
+// LINE has failed several times in a row: lookups give up, so that their
+// callers fall back, and pushes wait until LINE answers again. Replies and
+// leaving are never held back: reply tokens expire, and users are waiting.
+
+var (
+	// apiRates are the calls per second of each endpoint class.
+	apiRates = map[string]float64{
+		"reply":   100,
+		"push":    50,
+		"profile": 100,
+		"content": 20,
+	}
+	apiRetries      = 4
+	apiBackoff      = 500 * time.Millisecond
+	apiMaxBackoff   = 15 * time.Second
+	breakerFailures = 5
+	breakerCooldown = 30 * time.Second
+	breakerMaxWait  = 10 * time.Minute // how long a push waits for LINE
+)
+
+var errCircuitOpen = errors.New("LINE API is failing, call skipped")
+
+// setAPIRates changes apiRates from a spec like "push=20,profile=50".
+func setAPIRates(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if _, ok := apiRates[kv[0]]; !ok || len(kv) != 2 {
+			return fmt.Errorf("bad API rate %q: use class=calls per second, classes are reply, push, profile and content", part)
+		}
+		rate, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("bad API rate %q", part)
+		}
+		apiRates[kv[0]] = rate
+	}
+	return nil
+}
+
+// limiter lets calls through at most every interval.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until it is the caller's turn.
+func (l *limiter) wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(d)
+}
+
+// breaker opens after breakerFailures failed calls in a row and stays open
+// for breakerCooldown. Then it is half open: a single call probes LINE,
+// and a single failure opens it again.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	halfOpen  bool
+	probing   bool
+	probed    chan struct{} // closed when the probe is done
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !time.Now().Before(b.openUntil)
+}
+
+// pause blocks while the breaker is open or another call is probing, for at
+// most breakerMaxWait. It reports whether the caller may go ahead.
+func (b *breaker) pause() bool {
+	deadline := time.Now().Add(breakerMaxWait)
+	b.mu.Lock()
+	for {
+		now := time.Now()
+		if !now.Before(deadline) {
+			b.mu.Unlock()
+			return false
+		}
+		switch {
+		case now.Before(b.openUntil):
+			d := b.openUntil.Sub(now)
+			if left := deadline.Sub(now); d > left {
+				d = left
+			}
+			b.mu.Unlock()
+			time.Sleep(d)
+			b.mu.Lock()
+		case b.probing:
+			probed := b.probed
+			b.mu.Unlock()
+			<-probed
+			b.mu.Lock()
+		default:
+			if b.halfOpen {
+				b.probing = true
+				b.probed = make(chan struct{})
+			}
+			b.mu.Unlock()
+			return true
+		}
+	}
+}
+
+// record counts err. Errors such as a bad request show LINE is up.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.probing {
+		b.probing = false
+		close(b.probed)
+	}
+	if !retryable(err) {
+		b.failures = 0
+		b.halfOpen = false
+		return
+	}
+	b.failures++
+	if b.failures >= breakerFailures {
+		b.openUntil = time.Now().Add(breakerCooldown)
+		b.failures = breakerFailures - 1
+		b.halfOpen = true
+		log.Printf("LINE API is failing, holding back pushes and lookups for %v", breakerCooldown)
+	}
+}
+
+// retryable tells whether err is LINE throttling or failing.
+func retryable(err error) bool {
+	var e *linebot.APIError
+	return errors.As(err, &e) && (e.Code == http.StatusTooManyRequests || e.Code >= 500)
+}
+
+// backoff is how long to wait before retry n, counting from 0: doubling
+// each time, up to apiMaxBackoff, of which a random half.
+func backoff(n int) time.Duration {
+	d := apiBackoff << uint(n)
+	if d <= 0 || d > apiMaxBackoff {
+		d = apiMaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// newRetryKey makes a random UUID for X-Line-Retry-Key.
+func newRetryKey() string {
+	var b [16]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		log.Print(err)
+		rand.Read(b[:])
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// retryKeyPusher can push with a retry key, so that LINE delivers a push
+// that is retried only once.
+type retryKeyPusher interface {
+	pushWithRetryKey(key, to string, messages ...linebot.SendingMessage) error
+}
+
+// limitedAPI is a botAPI that paces and retries the calls of another.
+type limitedAPI struct {
+	api     botAPI
+	limits  map[string]*limiter
+	breaker breaker
+}
+
+func newLimitedAPI(api botAPI) *limitedAPI {
+	a := &limitedAPI{api: api, limits: map[string]*limiter{}}
+	for class, rate := range apiRates {
+		a.limits[class] = &limiter{interval: time.Duration(float64(time.Second) / rate)}
+	}
+	return a
+}
+
+// hold is what a call does while the breaker is open.
+type hold int
+
+const (
+	skipWhenOpen hold = iota // give up, for lookups that have a fallback
+	waitWhenOpen             // wait for LINE to recover, for pushes
+	neverHold                // go ahead, for replies and leaving
+)
+
+// call runs fn in its class's turn, retrying it while LINE throttles or
+// fails, and holding it as h says while the breaker is open.
+func (a *limitedAPI) call(class string, h hold, fn func() error) error {
+	for n := 0; ; n++ {
+		switch {
+		case h == skipWhenOpen && !a.breaker.allow():
+			return errCircuitOpen
+		case h == waitWhenOpen && !a.breaker.pause():
+			return errCircuitOpen
+		}
+		a.limits[class].wait()
+		err := fn()
+		a.breaker.record(err)
+		if !retryable(err) || n >= apiRetries {
+			return err
+		}
+		time.Sleep(backoff(n))
+	}
+}
+
+func (a *limitedAPI) ReplyMessage(replyToken string, messages ...linebot.SendingMessage) error {
+	return a.call("reply", neverHold, func() error {
+		return a.api.ReplyMessage(replyToken, messages...)
+	})
+}
+
+func (a *limitedAPI) PushMessage(to string, messages ...linebot.SendingMessage) error {
+	p, ok := a.api.(retryKeyPusher)
+	if !ok {
+		return a.call("push", waitWhenOpen, func() error {
+			return a.api.PushMessage(to, messages...)
+		})
+	}
+	key := newRetryKey()
+	return a.call("push", waitWhenOpen, func() error {
+		err := p.pushWithRetryKey(key, to, messages...)
+		var e *linebot.APIError
+		if errors.As(err, &e) && e.Code == http.StatusConflict {
+			// An earlier try with this key got through.
+			return nil
+		}
+		return err
+	})
+}
+
+func (a *limitedAPI) profile(fn func() (*linebot.UserProfileResponse, error)) (*linebot.UserProfileResponse, error) {
+	var res *linebot.UserProfileResponse
+	err := a.call("profile", skipWhenOpen, func() (err error) {
+		res, err = fn()
+		return err
+	})
+	return res, err
+}
+
+func (a *limitedAPI) GetProfile(userID string) (*linebot.UserProfileResponse, error) {
+	return a.profile(func() (*linebot.UserProfileResponse, error) { return a.api.GetProfile(userID) })
+}
+
+func (a *limitedAPI) GetGroupMemberProfile(groupID, userID string) (*linebot.UserProfileResponse, error) {
+	return a.profile(func() (*linebot.UserProfileResponse, error) { return a.api.GetGroupMemberProfile(groupID, userID) })
+}
+
+func (a *limitedAPI) GetRoomMemberProfile(roomID, userID string) (*linebot.UserProfileResponse, error) {
+	return a.profile(func() (*linebot.UserProfileResponse, error) { return a.api.GetRoomMemberProfile(roomID, userID) })
+}
+
+func (a *limitedAPI) GetGroupMemberIDs(groupID, start string) (res *linebot.MemberIDsResponse, err error) {
+	err = a.call("profile", skipWhenOpen, func() (err error) {
+		res, err = a.api.GetGroupMemberIDs(groupID, start)
+		return err
+	})
+	return res, err
+}
+
+func (a *limitedAPI) GetRoomMemberIDs(roomID, start string) (res *linebot.MemberIDsResponse, err error) {
+	err = a.call("profile", skipWhenOpen, func() (err error) {
+		res, err = a.api.GetRoomMemberIDs(roomID, start)
+		return err
+	})
+	return res, err
+}
+
+func (a *limitedAPI) GetGroupSummary(groupID string) (res *linebot.GroupSummaryResponse, err error) {
+	err = a.call("profile", skipWhenOpen, func() (err error) {
+		res, err = a.api.GetGroupSummary(groupID)
+		return err
+	})
+	return res, err
+}
+
+func (a *limitedAPI) GetGroupMemberCount(groupID string) (n int, err error) {
+	err = a.call("profile", skipWhenOpen, func() (err error) {
+		n, err = a.api.GetGroupMemberCount(groupID)
+		return err
+	})
+	return n, err
+}
+
+func (a *limitedAPI) GetRoomMemberCount(roomID string) (n int, err error) {
+	err = a.call("profile", skipWhenOpen, func() (err error) {
+		n, err = a.api.GetRoomMemberCount(roomID)
+		return err
+	})
+	return n, err
+}
+
+func (a *limitedAPI) LeaveGroup(groupID string) error {
+	return a.call("push", neverHold, func() error { return a.api.LeaveGroup(groupID) })
+}
+
+func (a *limitedAPI) LeaveRoom(roomID string) error {
+	return a.call("push", neverHold, func() error { return a.api.LeaveRoom(roomID) })
+}
+
+func (a *limitedAPI) GetMessageContent(messageID string) (res *linebot.MessageContentResponse, err error) {
+	err = a.call("content", skipWhenOpen, func() (err error) {
+		res, err = a.api.GetMessageContent(messageID)
+		return err
+	})
+	return res, err
+}
+
+func (a *limitedAPI) GetMessageQuotaLeft() (n int64, err error) {
+	err = a.call("profile", skipWhenOpen, func() (err error) {
+		n, err = a.api.GetMessageQuotaLeft()
+		return err
+	})
+	return n, err
+}
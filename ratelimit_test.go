@@ -0,0 +1,214 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// fakeLINE is a local stand-in for the Messaging API. It answers each
+// request with the next status of its script, then with 200.
+type fakeLINE struct {
+	mu       sync.Mutex
+	script   []int
+	requests []string // path and retry key
+}
+
+func (f *fakeLINE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.URL.Path+" "+r.Header.Get("X-Line-Retry-Key"))
+	status := http.StatusOK
+	if len(f.script) > 0 {
+		status, f.script = f.script[0], f.script[1:]
+	}
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if status == http.StatusOK {
+		fmt.Fprint(w, "{}")
+	} else {
+		fmt.Fprint(w, `{"message":"scripted"}`)
+	}
+}
+
+func (f *fakeLINE) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// useFakeLINE returns a limitedAPI over a client of a fake LINE server with
+// quick backoff, and restores the settings when the test ends.
+func useFakeLINE(t *testing.T, script ...int) (*limitedAPI, *fakeLINE) {
+	t.Helper()
+	f := &fakeLINE{script: script}
+	srv := httptest.NewServer(f)
+	backoff, failures := apiBackoff, breakerFailures
+	apiBackoff = time.Millisecond
+	t.Cleanup(func() {
+		srv.Close()
+		apiBackoff, breakerFailures = backoff, failures
+	})
+	c, err := linebot.New("secret", "token", linebot.WithEndpointBase(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newLimitedAPI(lineAPI{c}), f
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   []int
+		wantErr  bool
+		requests int
+	}{
+		{"ok", nil, false, 1},
+		{"throttled, then ok", []int{429, 429}, false, 3},
+		{"failing, then ok", []int{500, 503}, false, 3},
+		{"delivered before", []int{502, 409}, false, 2},
+		{"bad request", []int{400}, true, 1},
+		{"failing for good", []int{500, 500, 500, 500, 500, 500}, true, apiRetries + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, f := useFakeLINE(t, tt.script...)
+			err := api.PushMessage("G1", linebot.NewTextMessage("hi"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v", err)
+			}
+			requests := f.Requests()
+			if len(requests) != tt.requests {
+				t.Fatalf("got requests %q, want %d", requests, tt.requests)
+			}
+			for _, r := range requests {
+				if r != requests[0] || len(r) != len("/v2/bot/message/push ")+36 {
+					t.Errorf("requests %q do not share one retry key", requests)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryKeyIsPerPush(t *testing.T) {
+	api, f := useFakeLINE(t)
+	api.PushMessage("G1", linebot.NewTextMessage("one"))
+	api.PushMessage("G1", linebot.NewTextMessage("two"))
+	api.ReplyMessage("T", linebot.NewTextMessage("three"))
+	requests := f.Requests()
+	if requests[0] == requests[1] {
+		t.Errorf("two pushes share a retry key: %q", requests)
+	}
+	if requests[2] != "/v2/bot/message/reply " {
+		t.Errorf("the retry key stuck to the client: %q", requests[2])
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	api, f := useFakeLINE(t, 503, 503, 503, 503, 503, 503)
+	breakerFailures = 3
+	cooldown := breakerCooldown
+	breakerCooldown = 20 * time.Millisecond
+	defer func() { breakerCooldown = cooldown }()
+	if _, err := api.GetProfile("U1"); err == nil {
+		t.Fatal("a failing lookup succeeded")
+	}
+	if n := len(f.Requests()); n != breakerFailures {
+		t.Errorf("got %d requests before the breaker opened, want %d", n, breakerFailures)
+	}
+	if _, err := api.GetProfile("U1"); err != errCircuitOpen {
+		t.Errorf("lookup while open: got %v, want %v", err, errCircuitOpen)
+	}
+
+	// A push waits out the cooldown, probes, and keeps waiting while LINE
+	// fails the probes, until it gets through.
+	start := time.Now()
+	if err := api.PushMessage("G1", linebot.NewTextMessage("hi")); err != nil {
+		t.Errorf("push while open: %v", err)
+	}
+	if d := time.Since(start); d < breakerCooldown {
+		t.Errorf("the push went out after %v, before the cooldown", d)
+	}
+	requests := f.Requests()
+	if n := len(requests); n != 7 || requests[n-1][:len("/v2/bot/message/push")] != "/v2/bot/message/push" {
+		t.Errorf("got requests %q, want the push to be delivered last", requests)
+	}
+	if !api.breaker.allow() || api.breaker.halfOpen {
+		t.Error("the breaker is not closed after the push got through")
+	}
+
+	f.mu.Lock()
+	f.script = []int{503, 503, 503}
+	f.mu.Unlock()
+	api.GetProfile("U1")
+	if err := api.ReplyMessage("T", linebot.NewTextMessage("hi")); err != nil {
+		t.Errorf("reply while open: %v", err)
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	api, f := useFakeLINE(t, 503, 503)
+	breakerFailures = 2
+	cooldown := breakerCooldown
+	breakerCooldown = 20 * time.Millisecond
+	defer func() { breakerCooldown = cooldown }()
+	api.GetProfile("U1")
+
+	// Pushes waiting on an open breaker are let through one at a time
+	// until one gets through.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := api.PushMessage("G1", linebot.NewTextMessage("hi")); err != nil {
+				t.Errorf("push: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(f.Requests()); n != 2+5 {
+		t.Errorf("got %d requests, want the 2 lookups and 5 pushes", n)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{interval: 10 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		l.wait()
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("5 calls took %v, want at least 40ms", d)
+	}
+}
+
+func TestSetAPIRates(t *testing.T) {
+	push := apiRates["push"]
+	defer func() { apiRates["push"] = push }()
+	if err := setAPIRates("push=5, "); err != nil || apiRates["push"] != 5 {
+		t.Errorf("got %v, push rate %v", err, apiRates["push"])
+	}
+	for _, spec := range []string{"push", "push=0", "multicast=3", "push=x"} {
+		if err := setAPIRates(spec); err == nil {
+			t.Errorf("%q was accepted", spec)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders for image.Decode
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	repostThreshold  = 6 // differing bits out of 64
+	repostMaxBits    = 20
+	repostIndexSize  = 2000
+	repostImageLimit = 10 << 20
+	repostMaxPixels  = 50 << 20 // width × height, to keep decoding in memory bounds
+)
+
+func init() {
+	registerCommand("repost", repostCommand)
+	registerHelp("repost", commandHelp{
+		Summary:    "Point out images that were posted before",
+		SummaryFa:  "هشدار برای تصویرهای تکراری",
+		Usage:      []string{"/repost"},
+		AdminUsage: []string{"/repost on", "/repost off", "/repost threshold 8"},
+		Where:      inShared,
+	})
+}
+
+// postedImage is an image seen in a chat, identified by its perceptual hash.
+type postedImage struct {
+	Hash   uint64    `json:"hash"`
+	UserID string    `json:"userId"`
+	Time   time.Time `json:"time"`
+}
+
+// chatImages is the image index of a group or room. Detection is off until
+// an admin turns it on.
+type chatImages struct {
+	Enabled   bool          `json:"enabled"`
+	Threshold int           `json:"threshold"`
+	Images    []postedImage `json:"images"`
+}
+
+// reposts holds the image index of every group and room.
+var reposts = &repostIndex{Chats: map[string]*chatImages{}}
+
+type repostIndex struct {
+	mu    sync.Mutex
+	Chats map[string]*chatImages `json:"chats"`
+}
+
+func (x *repostIndex) load() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := db.load("reposts", x); err != nil {
+		log.Print(err)
+	}
+}
+
+func (x *repostIndex) chat(id string) *chatImages {
+	c := x.Chats[id]
+	if c == nil {
+		c = &chatImages{Threshold: repostThreshold}
+		x.Chats[id] = c
+	}
+	return c
+}
+
+func (x *repostIndex) settings(id string) (enabled bool, threshold int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	c := x.chat(id)
+	return c.Enabled, c.Threshold
+}
+
+// update changes the settings of chat id with fn and saves them.
+func (x *repostIndex) update(id string, fn func(c *chatImages)) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	fn(x.chat(id))
+	if err := db.save("reposts", x); err != nil {
+		log.Print(err)
+	}
+}
+
+// forgetChat empties the image index of chat id, keeping its settings.
+func (x *repostIndex) forgetChat(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if c := x.Chats[id]; c != nil && len(c.Images) > 0 {
+		c.Images = nil
+		if err := db.save("reposts", x); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// check returns an earlier image of chat id close to hash, or adds hash to
+// the index if there is none.
+func (x *repostIndex) check(id string, img postedImage) (postedImage, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	c := x.chat(id)
+	for _, seen := range c.Images {
+		if bits.OnesCount64(seen.Hash^img.Hash) <= c.Threshold {
+			return seen, true
+		}
+	}
+	c.Images = append(c.Images, img)
+	if len(c.Images) > repostIndexSize {
+		c.Images = c.Images[len(c.Images)-repostIndexSize:]
+	}
+	if err := db.save("reposts", x); err != nil {
+		log.Print(err)
+	}
+	return postedImage{}, false
+}
+
+// dHash is a 64-bit difference hash: the image is shrunk to 9×8 gray pixels
+// and each bit tells whether a pixel is brighter than its right neighbour.
+// Resized, recompressed or slightly edited copies get hashes a few bits apart.
+func dHash(img image.Image) uint64 {
+	var gray [8][9]float64
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	for y := 0; y < 8; y++ {
+		y0, y1 := b.Min.Y+y*h/8, b.Min.Y+(y+1)*h/8
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < 9; x++ {
+			x0, x1 := b.Min.X+x*w/9, b.Min.X+(x+1)*w/9
+			if x1 == x0 {
+				x1++
+			}
+			var sum float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, bl, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+				}
+			}
+			gray[y][x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// imageHash hashes the image read from r.
+func imageHash(r io.Reader) (uint64, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, repostImageLimit))
+	if err != nil {
+		return 0, err
+	}
+	// A small file can claim a huge size, so check it before decoding.
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > repostMaxPixels {
+		return 0, fmt.Errorf("image is %d×%d pixels, too large to hash", config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	return dHash(img), nil
+}
+
+// spotsReposts tells whether images sent from src are checked for reposts.
+func spotsReposts(src *linebot.EventSource) bool {
+	id := sourceID(src)
+	enabled, _ := reposts.settings(id)
+	return enabled && id != src.UserID
+}
+
+// spotRepost points out in the chat of src if the image read from r, sent
+// at, was posted there before. The reply token belongs to commands and
+// notes, so the warning is pushed.
+func spotRepost(src *linebot.EventSource, r io.Reader, at time.Time) {
+	imgHash, err := imageHash(r)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	id := sourceID(src)
+	seen, dup := reposts.check(id, postedImage{Hash: imgHash, UserID: src.UserID, Time: at})
+	if !dup {
+		return
+	}
+	pushMessage(id, linebot.NewTextMessage(fmt.Sprintf("♻️ Already posted by %s on %s.", displayName(src, seen.UserID), seen.Time.Format("2006-01-02"))))
+}
+
+func repostCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	id := sourceID(event.Source)
+	if len(args) == 0 {
+		enabled, threshold := reposts.settings(id)
+		state := "off"
+		if enabled {
+			state = "on"
+		}
+		return textReplyf("♻️ Repost detection is %s, threshold %d of 64 bits.", state, threshold)
+	}
+	if !isAdmin(event.Source) {
+		return textReplyf("Only admins can change repost detection.")
+	}
+	sub := strings.ToLower(args[0])
+	switch {
+	case sub == "on" || sub == "off":
+		reposts.update(id, func(c *chatImages) { c.Enabled = sub == "on" })
+		return textReplyf("♻️ Repost detection turned %s.", sub)
+	case sub == "threshold" && len(args) > 1:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > repostMaxBits {
+			return textReplyf("The threshold must be 0-%d. Lower only matches closer copies.", repostMaxBits)
+		}
+		reposts.update(id, func(c *chatImages) { c.Threshold = n })
+		return textReplyf("♻️ Threshold set to %d.", n)
+	}
+	return textReplyf("Usage: /repost, /repost on|off, /repost threshold <0-%d>", repostMaxBits)
+}
@@ -0,0 +1,93 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestImageHashSize(t *testing.T) {
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imageHash(bytes.NewReader(b.Bytes())); err != nil {
+		t.Errorf("a small image: %v", err)
+	}
+
+	// The same file, claiming to be 100000×100000 pixels.
+	data := b.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	if _, err := imageHash(bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("a huge image: %v", err)
+	}
+}
+
+func TestRepostHook(t *testing.T) {
+	f := useFake(t)
+	f.profiles["U2"] = &linebot.UserProfileResponse{UserID: "U2", DisplayName: "Bob"}
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	f.content = b.String()
+	reposts.Chats = map[string]*chatImages{"G1": {Enabled: true, Threshold: repostThreshold}}
+	defer func() {
+		reposts.Chats = map[string]*chatImages{}
+		archives.Chats = map[string]*chatArchive{}
+	}()
+	bob := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: "U2"}
+	send := func(src *linebot.EventSource, messageID string) {
+		handleEvent(f, &linebot.Event{Type: linebot.EventTypeMessage, ReplyToken: "T", Source: src, Timestamp: time.Now(), Message: &linebot.ImageMessage{ID: messageID}})
+	}
+
+	indexed := func() int {
+		reposts.mu.Lock()
+		defer reposts.mu.Unlock()
+		return len(reposts.Chats["G1"].Images)
+	}
+	send(inGroup, "M1")
+	for i := 0; i < 100 && indexed() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	send(bob, "M2")
+	waitForCall(t, f, "push G1: ♻️ Already posted by Alice on ")
+
+	// With archiving on, the image is downloaded once for both.
+	archives.Chats = map[string]*chatArchive{"G1": {Enabled: true, QuotaMB: archiveQuotaMB}}
+	f.calls = nil
+	send(bob, "M3")
+	waitForCall(t, f, "push G1: ♻️")
+	for i := 0; i < 100 && len(archives.get("G1").Items) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkCalls(t, f.Calls(), []string{"content M3", "group profile G1 U1", "push G1: ♻️ Already posted by Alice"})
+	if items := archives.get("G1").Items; len(items) != 1 || items[0].MessageID != "M3" {
+		t.Errorf("archived %+v", items)
+	}
+}
@@ -0,0 +1,302 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Rich menus are deployed from a JSON spec: a LINE rich menu object, plus
+// "default": true to make it the menu every user sees. Menus are matched to
+// live ones by name. Postback areas whose data starts with "/" run that
+// command, e.g. {"type": "postback", "data": "/quote random"}.
+
+const richMenuUsage = `usage:
+  richmenu apply [-dry-run] <menu.json> <image>
+  richmenu list
+  richmenu delete <id or name>
+  richmenu set-default <id or name>
+  richmenu link <id or name> <user ID>...
+The spec must be JSON; YAML is not supported.`
+
+type richMenuSpec struct {
+	linebot.RichMenuResponse
+	Default bool `json:"default"`
+}
+
+func richMenuCLI(args []string) error {
+	if len(args) == 0 {
+		return errors.New(richMenuUsage)
+	}
+	switch args[0] {
+	case "apply":
+		fs := flag.NewFlagSet("richmenu apply", flag.ContinueOnError)
+		dryRun := fs.Bool("dry-run", false, "only show what would change")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 2 {
+			return errors.New(richMenuUsage)
+		}
+		return applyRichMenu(fs.Arg(0), fs.Arg(1), *dryRun)
+	case "list":
+		return listRichMenus()
+	case "delete", "set-default":
+		if len(args) != 2 {
+			return errors.New(richMenuUsage)
+		}
+		menu, err := findRichMenu(args[1])
+		if err != nil {
+			return err
+		}
+		if args[0] == "delete" {
+			_, err = bot.DeleteRichMenu(menu.RichMenuID).Do()
+		} else {
+			_, err = bot.SetDefaultRichMenu(menu.RichMenuID).Do()
+		}
+		if err == nil {
+			fmt.Printf("%s %s (%s)\n", args[0], menu.Name, menu.RichMenuID)
+		}
+		return err
+	case "link":
+		if len(args) < 3 {
+			return errors.New(richMenuUsage)
+		}
+		menu, err := findRichMenu(args[1])
+		if err != nil {
+			return err
+		}
+		if len(args) == 3 {
+			_, err = bot.LinkUserRichMenu(args[2], menu.RichMenuID).Do()
+		} else {
+			_, err = bot.BulkLinkRichMenu(menu.RichMenuID, args[2:]...).Do()
+		}
+		if err == nil {
+			fmt.Printf("linked %d users to %s\n", len(args)-2, menu.Name)
+		}
+		return err
+	}
+	return errors.New(richMenuUsage)
+}
+
+func listRichMenus() error {
+	menus, err := bot.GetRichMenuList().Do()
+	if err != nil {
+		return err
+	}
+	defaultID := ""
+	if res, err := bot.GetDefaultRichMenu().Do(); err == nil {
+		defaultID = res.RichMenuID
+	}
+	for _, m := range menus {
+		mark := " "
+		if m.RichMenuID == defaultID {
+			mark = "*"
+		}
+		fmt.Printf("%s %s  %-20s %dx%d  %q  %d areas\n", mark, m.RichMenuID, m.Name, m.Size.Width, m.Size.Height, m.ChatBarText, len(m.Areas))
+	}
+	return nil
+}
+
+// findRichMenu looks a live menu up by ID or by name.
+func findRichMenu(ref string) (*linebot.RichMenuResponse, error) {
+	menus, err := bot.GetRichMenuList().Do()
+	if err != nil {
+		return nil, err
+	}
+	var found []*linebot.RichMenuResponse
+	for _, m := range menus {
+		if m.RichMenuID == ref || m.Name == ref {
+			found = append(found, m)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no rich menu %q", ref)
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("%d rich menus are named %q, use an ID", len(found), ref)
+}
+
+func loadRichMenuSpec(path string) (*richMenuSpec, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, fmt.Errorf("%s: only JSON specs are supported", path)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec richMenuSpec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if spec.Name == "" || spec.Size.Width == 0 || spec.Size.Height == 0 || len(spec.Areas) == 0 {
+		return nil, fmt.Errorf("%s: name, size and areas are required", path)
+	}
+	return &spec, nil
+}
+
+// diffRichMenu describes how the live menu differs from the spec and its
+// image. An empty result means they are the same.
+func diffRichMenu(spec *richMenuSpec, image []byte, live *linebot.RichMenuResponse) ([]string, error) {
+	var diff []string
+	if spec.Size != live.Size {
+		diff = append(diff, fmt.Sprintf("~ size: %dx%d -> %dx%d", live.Size.Width, live.Size.Height, spec.Size.Width, spec.Size.Height))
+	}
+	if spec.Selected != live.Selected {
+		diff = append(diff, fmt.Sprintf("~ selected: %v -> %v", live.Selected, spec.Selected))
+	}
+	if spec.ChatBarText != live.ChatBarText {
+		diff = append(diff, fmt.Sprintf("~ chatBarText: %q -> %q", live.ChatBarText, spec.ChatBarText))
+	}
+	for i := 0; i < len(spec.Areas) || i < len(live.Areas); i++ {
+		var want, have []byte
+		if i < len(spec.Areas) {
+			want, _ = json.Marshal(spec.Areas[i])
+		}
+		if i < len(live.Areas) {
+			have, _ = json.Marshal(live.Areas[i])
+		}
+		if !bytes.Equal(want, have) {
+			if have != nil {
+				diff = append(diff, fmt.Sprintf("- areas[%d]: %s", i, have))
+			}
+			if want != nil {
+				diff = append(diff, fmt.Sprintf("+ areas[%d]: %s", i, want))
+			}
+		}
+	}
+	res, err := bot.DownloadRichMenuImage(live.RichMenuID).Do()
+	if err != nil {
+		return nil, err
+	}
+	defer res.Content.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, res.Content); err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(image); !bytes.Equal(sum[:], h.Sum(nil)) {
+		diff = append(diff, "~ image changed")
+	}
+	return diff, nil
+}
+
+// applyRichMenu makes the live menus match the spec: an unchanged menu is
+// kept, otherwise a new one is created and the old ones with its name are
+// deleted.
+func applyRichMenu(specPath, imagePath string, dryRun bool) error {
+	spec, err := loadRichMenuSpec(specPath)
+	if err != nil {
+		return err
+	}
+	image, err := ioutil.ReadFile(imagePath)
+	if err != nil {
+		return err
+	}
+	menus, err := bot.GetRichMenuList().Do()
+	if err != nil {
+		return err
+	}
+	var old []*linebot.RichMenuResponse
+	var current *linebot.RichMenuResponse
+	for _, m := range menus {
+		if m.Name != spec.Name {
+			continue
+		}
+		diff, err := diffRichMenu(spec, image, m)
+		if err != nil {
+			return err
+		}
+		if len(diff) == 0 && current == nil {
+			current = m
+			continue
+		}
+		fmt.Printf("%s (%s):\n  %s\n", m.Name, m.RichMenuID, strings.Join(diff, "\n  "))
+		old = append(old, m)
+	}
+	if current != nil {
+		fmt.Printf("%s is up to date (%s)\n", spec.Name, current.RichMenuID)
+	} else {
+		fmt.Printf("+ create %s\n", spec.Name)
+	}
+	for _, m := range old {
+		fmt.Printf("- delete %s\n", m.RichMenuID)
+	}
+	if dryRun {
+		return nil
+	}
+
+	if current == nil {
+		res, err := bot.CreateRichMenu(linebot.RichMenu{
+			Size:        spec.Size,
+			Selected:    spec.Selected,
+			Name:        spec.Name,
+			ChatBarText: spec.ChatBarText,
+			Areas:       spec.Areas,
+		}).Do()
+		if err != nil {
+			return err
+		}
+		if _, err := bot.UploadRichMenuImage(res.RichMenuID, imagePath).Do(); err != nil {
+			bot.DeleteRichMenu(res.RichMenuID).Do()
+			return err
+		}
+		current = &linebot.RichMenuResponse{RichMenuID: res.RichMenuID}
+		fmt.Printf("created %s\n", res.RichMenuID)
+	}
+	if spec.Default {
+		if _, err := bot.SetDefaultRichMenu(current.RichMenuID).Do(); err != nil {
+			return err
+		}
+		fmt.Printf("default is %s\n", current.RichMenuID)
+	}
+	for _, m := range old {
+		if _, err := bot.DeleteRichMenu(m.RichMenuID).Do(); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %s\n", m.RichMenuID)
+	}
+	return nil
+}
+
+// commandLine runs a subcommand of the bot binary instead of the server.
+func commandLine(args []string) error {
+	switch args[0] {
+	case "richmenu":
+		return richMenuCLI(args[1:])
+	case "webhook":
+		return webhookCLI(args[1:])
+	}
+	return fmt.Errorf("unknown command %q, commands: richmenu, webhook", args[0])
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
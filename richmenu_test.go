@@ -0,0 +1,100 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestLoadRichMenuSpec(t *testing.T) {
+	spec, err := loadRichMenuSpec("richmenu/main.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Name != "main" || !spec.Default || len(spec.Areas) != 3 || spec.Areas[0].Action.Data != "/quote random" {
+		t.Errorf("richmenu/main.json: %+v", spec)
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"menu.yaml", "name: main", "only JSON specs are supported"},
+		{"menu.YML", "name: main", "only JSON specs are supported"},
+		{"broken.json", `{"name": "main",`, "unexpected end of JSON input"},
+		{"unnamed.json", `{"size": {"width": 2500, "height": 843}, "areas": [{}]}`, "name, size and areas are required"},
+		{"sizeless.json", `{"name": "main", "areas": [{}]}`, "name, size and areas are required"},
+		{"empty.json", `{"name": "main", "size": {"width": 2500, "height": 843}, "areas": []}`, "name, size and areas are required"},
+		{"missing.json", "", "no such file"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if tt.spec != "" {
+			if err := ioutil.WriteFile(path, []byte(tt.spec), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := loadRichMenuSpec(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDiffRichMenu(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("live image"))
+	}))
+	defer srv.Close()
+	client, err := linebot.New("secret", "token", linebot.WithEndpointBaseData(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := bot
+	bot = client
+	defer func() { bot = old }()
+
+	spec, err := loadRichMenuSpec("richmenu/main.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := spec.RichMenuResponse
+	live.RichMenuID = "RM1"
+	if diff, err := diffRichMenu(spec, []byte("live image"), &live); err != nil || len(diff) != 0 {
+		t.Errorf("an unchanged menu differs: %q, %v", diff, err)
+	}
+
+	live.ChatBarText = "Old menu"
+	live.Areas = live.Areas[:2]
+	diff, err := diffRichMenu(spec, []byte("new image"), &live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`~ chatBarText: "Old menu" -> "Menu"`, `+ areas[2]: {"bounds":`, "~ image changed"}
+	if len(diff) != len(want) {
+		t.Fatalf("diff %q, want %q", diff, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(diff[i], want[i]) {
+			t.Errorf("diff[%d] = %q, want %q", i, diff[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,522 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	searchHits      = 5
+	searchSnippet   = 80 // characters
+	searchSweepTime = time.Hour
+)
+
+// searchKeepDays is how long new indexes keep messages, from
+// SearchRetentionDays.
+var searchKeepDays = 90
+
+func init() {
+	registerCommand("search", searchCommand)
+	registerHelp("search", commandHelp{
+		Summary:    "Find older messages, once admins turned it on",
+		SummaryFa:  "جستجو در پیام‌های قبلی، اگر مدیران آن را روشن کرده باشند",
+		Usage:      []string{"/search", "/search picnic", "/search from:@member since:2026-10-01 picnic", "/search forget"},
+		AdminUsage: []string{"/search on", "/search keep 30", "/search off"},
+		Where:      inShared,
+	})
+	registerMessageHook(searchHook)
+}
+
+// indexedMessage is a text message kept for /search.
+type indexedMessage struct {
+	MessageID string    `json:"messageId"`
+	UserID    string    `json:"userId"`
+	Time      time.Time `json:"time"`
+	Text      string    `json:"text"`
+}
+
+// chatIndex holds the messages of one group or room and an inverted index
+// of their words. Indexing is off until an admin turns it on.
+type chatIndex struct {
+	Enabled  bool             `json:"enabled"`
+	KeepDays int              `json:"keepDays"`
+	Messages []indexedMessage `json:"messages"` // oldest first
+
+	words map[string][]int // word to positions in Messages
+}
+
+// add appends m and indexes its words.
+func (c *chatIndex) add(m indexedMessage) {
+	if c.words == nil {
+		c.reindex()
+	}
+	c.Messages = append(c.Messages, m)
+	for _, word := range uniqueWords(m.Text) {
+		c.words[word] = append(c.words[word], len(c.Messages)-1)
+	}
+}
+
+// reindex rebuilds the inverted index, after loading or removing messages.
+func (c *chatIndex) reindex() {
+	c.words = map[string][]int{}
+	for i, m := range c.Messages {
+		for _, word := range uniqueWords(m.Text) {
+			c.words[word] = append(c.words[word], i)
+		}
+	}
+}
+
+// remove drops the messages drop picks and tells how many there were.
+func (c *chatIndex) remove(drop func(m indexedMessage) bool) int {
+	kept := c.Messages[:0]
+	for _, m := range c.Messages {
+		if !drop(m) {
+			kept = append(kept, m)
+		}
+	}
+	n := len(c.Messages) - len(kept)
+	c.Messages = kept
+	if n > 0 {
+		c.reindex()
+	}
+	return n
+}
+
+// searchQuery is what /search looks for.
+type searchQuery struct {
+	Words []string
+	From  string
+	Since time.Time
+}
+
+// match scores the messages with word: 2 for the word itself, 1 for a
+// longer word it begins, from three letters on.
+func (c *chatIndex) match(word string) map[int]int {
+	scores := map[int]int{}
+	for w, positions := range c.words {
+		score := 0
+		switch {
+		case w == word:
+			score = 2
+		case utf8.RuneCountInString(word) >= 3 && strings.HasPrefix(w, word):
+			score = 1
+		default:
+			continue
+		}
+		for _, i := range positions {
+			if score > scores[i] {
+				scores[i] = score
+			}
+		}
+	}
+	return scores
+}
+
+// find returns the best matches of q, at most searchHits. Every word must
+// match; better matches and newer messages come first.
+func (c *chatIndex) find(q searchQuery) []indexedMessage {
+	if c.words == nil {
+		c.reindex()
+	}
+	var scores map[int]int
+	for _, word := range q.Words {
+		matched := c.match(word)
+		if scores == nil {
+			scores = matched
+			continue
+		}
+		for i := range scores {
+			if matched[i] == 0 {
+				delete(scores, i)
+			} else {
+				scores[i] += matched[i]
+			}
+		}
+	}
+	var hits []int
+	for i := range scores {
+		m := c.Messages[i]
+		if (q.From == "" || m.UserID == q.From) && !m.Time.Before(q.Since) {
+			hits = append(hits, i)
+		}
+	}
+	sort.Slice(hits, func(a, b int) bool {
+		if scores[hits[a]] != scores[hits[b]] {
+			return scores[hits[a]] > scores[hits[b]]
+		}
+		return hits[a] > hits[b]
+	})
+	if len(hits) > searchHits {
+		hits = hits[:searchHits]
+	}
+	found := make([]indexedMessage, len(hits))
+	for i, hit := range hits {
+		found[i] = c.Messages[hit]
+	}
+	return found
+}
+
+// searches holds the search index of every group and room.
+var searches = &searchBook{Chats: map[string]*chatIndex{}}
+
+type searchBook struct {
+	mu    sync.Mutex
+	saved time.Time
+	dirty bool
+	Chats map[string]*chatIndex `json:"chats"`
+}
+
+func (s *searchBook) load() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := db.load("search", s); err != nil {
+		log.Print(err)
+	}
+}
+
+// save writes the book out, at once if force is set and otherwise at most
+// once a minute. s.mu must be held.
+func (s *searchBook) save(force bool) {
+	s.dirty = true
+	if !force && time.Since(s.saved) < time.Minute {
+		return
+	}
+	s.saved, s.dirty = time.Now(), false
+	if err := db.save("search", s); err != nil {
+		log.Print(err)
+	}
+}
+
+// update changes the index of chat id with fn and saves it.
+func (s *searchBook) update(id string, fn func(c *chatIndex)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.Chats[id]
+	if c == nil {
+		c = &chatIndex{KeepDays: searchKeepDays}
+		s.Chats[id] = c
+	}
+	fn(c)
+	s.save(true)
+}
+
+// status tells whether chat id is indexed, for how long and how much.
+func (s *searchBook) status(id string) (enabled bool, keepDays, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.Chats[id]; c != nil {
+		return c.Enabled, c.KeepDays, len(c.Messages)
+	}
+	return false, searchKeepDays, 0
+}
+
+// add indexes m if chat id has indexing on.
+func (s *searchBook) add(id string, m indexedMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.Chats[id]
+	if c == nil || !c.Enabled {
+		return
+	}
+	c.add(m)
+	s.save(false)
+}
+
+func (s *searchBook) find(id string, q searchQuery) []indexedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.Chats[id]; c != nil {
+		return c.find(q)
+	}
+	return nil
+}
+
+// unsend drops a message its author took back.
+func (s *searchBook) unsend(id, messageID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.Chats[id]; c != nil && c.remove(func(m indexedMessage) bool { return m.MessageID == messageID }) > 0 {
+		s.save(true)
+	}
+}
+
+// forgetUser drops the messages of userID in chat id and tells how many.
+func (s *searchBook) forgetUser(id, userID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.Chats[id]
+	if c == nil {
+		return 0
+	}
+	n := c.remove(func(m indexedMessage) bool { return m.UserID == userID })
+	if n > 0 {
+		s.save(true)
+	}
+	return n
+}
+
+// forgetChat deletes the messages of chat id, keeping its settings.
+func (s *searchBook) forgetChat(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.Chats[id]; c != nil && len(c.Messages) > 0 {
+		c.Messages, c.words = nil, nil
+		s.save(true)
+	}
+}
+
+// expire drops messages older than each chat keeps them, and writes out
+// what was added since the last save.
+func (s *searchBook) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := 0
+	for _, c := range s.Chats {
+		if c.KeepDays == 0 {
+			continue
+		}
+		cutoff := time.Now().AddDate(0, 0, -c.KeepDays)
+		dropped += c.remove(func(m indexedMessage) bool { return m.Time.Before(cutoff) })
+	}
+	if dropped > 0 || s.dirty {
+		s.save(true)
+	}
+}
+
+// sweepSearch applies the retention of every index periodically.
+func sweepSearch() {
+	for {
+		searches.expire()
+		scheduled("Search retention", time.Now(), time.Now().Add(searchSweepTime))
+		time.Sleep(searchSweepTime)
+	}
+}
+
+// searchHook indexes the text messages of chats that turned search on.
+func searchHook(api botAPI, event *linebot.Event) {
+	m, ok := event.Message.(*linebot.TextMessage)
+	if !ok || event.Source.Type == linebot.EventSourceTypeUser || strings.HasPrefix(m.Text, "/") {
+		return
+	}
+	searches.add(sourceID(event.Source), indexedMessage{
+		MessageID: m.ID,
+		UserID:    event.Source.UserID,
+		Time:      event.Timestamp,
+		Text:      m.Text,
+	})
+}
+
+// searchFold maps letters with several forms in Persian text to one of them
+// and digits to ASCII, and drops diacritics and joiners. -1 drops a rune.
+func searchFold(r rune) rune {
+	switch {
+	case r == 'ي' || r == 'ى':
+		return 'ی'
+	case r == 'ك':
+		return 'ک'
+	case r == 'ة':
+		return 'ه'
+	case r == 'أ' || r == 'إ' || r == 'ٱ' || r == 'آ':
+		return 'ا'
+	case r == 'ؤ':
+		return 'و'
+	case r >= '۰' && r <= '۹':
+		return '0' + r - '۰'
+	case r >= '٠' && r <= '٩':
+		return '0' + r - '٠'
+	case r >= 0x064B && r <= 0x065F, r == 0x0670, r == 0x0640, r == 0x200C, r == 0x200D:
+		return -1
+	}
+	return unicode.ToLower(r)
+}
+
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an and are as at be but by for from has have i in is it its
+		me my of on or so that the this to was we were what with you your
+		و در به از که این آن را با است برای یک هم تا یا اما من تو او ما شما
+		ایشان هست بود شد می نه اگر چه همه`) {
+		stopWords[strings.Map(searchFold, w)] = true
+	}
+}
+
+// words splits text into folded words, leaving out stop words and single
+// letters.
+func words(text string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.Map(searchFold, text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if utf8.RuneCountInString(w) > 1 && !stopWords[w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func uniqueWords(text string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, w := range words(text) {
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// withoutMentions returns the text of a message with the mentions blanked
+// out. LINE counts their positions in UTF-16 code units.
+func withoutMentions(m *linebot.TextMessage) string {
+	if m.Mention == nil {
+		return m.Text
+	}
+	units := utf16.Encode([]rune(m.Text))
+	for _, mention := range m.Mention.Mentionees {
+		for i := mention.Index; i < mention.Index+mention.Length && i < len(units); i++ {
+			units[i] = ' '
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// parseSearch reads the options and words of a /search message.
+func parseSearch(event *linebot.Event) (searchQuery, error) {
+	var q searchQuery
+	m, ok := event.Message.(*linebot.TextMessage)
+	if !ok {
+		return q, nil
+	}
+	fields := strings.Fields(withoutMentions(m))
+	for _, field := range fields[1:] {
+		lower := strings.ToLower(field)
+		switch {
+		case strings.HasPrefix(lower, "from:"):
+			mentioned := mentions(event)
+			if len(mentioned) == 0 {
+				return q, fmt.Errorf("mention the member after from:")
+			}
+			q.From = mentioned[0]
+		case strings.HasPrefix(lower, "since:"):
+			t, err := time.ParseInLocation("2006-01-02", field[len("since:"):], time.Local)
+			if err != nil {
+				return q, fmt.Errorf("write the date after since: like 2026-10-01")
+			}
+			q.Since = t
+		default:
+			q.Words = append(q.Words, words(field)...)
+		}
+	}
+	return q, nil
+}
+
+// snippet is the part of text around the first of the query words.
+func snippet(text string, query []string) string {
+	runes := []rune(text)
+	var folded []rune
+	var at []int // position in runes of each folded rune
+	for i, r := range runes {
+		if f := searchFold(r); f >= 0 {
+			folded = append(folded, f)
+			at = append(at, i)
+		}
+	}
+	start := 0
+	for _, word := range query {
+		if j := strings.Index(string(folded), word); j >= 0 {
+			start = at[utf8.RuneCountInString(string(folded)[:j])]
+			break
+		}
+	}
+	if start -= searchSnippet / 4; start < 0 {
+		start = 0
+	}
+	s := strings.Join(strings.Fields(string(runes[start:])), " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	return truncate(s, searchSnippet)
+}
+
+func searchCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	if event.Source.GroupID == "" && event.Source.RoomID == "" {
+		return textReplyf("/search only works in a group or room.")
+	}
+	id := sourceID(event.Source)
+	enabled, keepDays, n := searches.status(id)
+	if len(args) == 0 {
+		if !enabled {
+			return textReplyf("🔎 Search is off here. Admins can turn it on with /search on.")
+		}
+		return textReplyf("🔎 Search is on: %d messages from the last %d days can be found. /search forget removes yours.\nUsage: /search [from:@member] [since:2026-10-01] words", n, keepDays)
+	}
+	switch sub := strings.ToLower(args[0]); {
+	case sub == "forget" && len(args) == 1:
+		return textReplyf("🔎 Removed %d of your messages from the search.", searches.forgetUser(id, event.Source.UserID))
+	case sub == "on" || sub == "off" || sub == "keep":
+		if !isAdmin(event.Source) {
+			return textReplyf("Only admins can change search.")
+		}
+		switch {
+		case sub == "on":
+			searches.update(id, func(c *chatIndex) { c.Enabled = true })
+			return textReplyf("🔎 Notice: from now on I keep the text of messages sent here for %d days, so that members can find them with /search. Commands, media and one-on-one chats are not kept. Anyone can remove their own messages with /search forget, and unsent messages are removed too. Admins can stop this with /search off, which deletes everything kept.", keepDays)
+		case sub == "off":
+			searches.update(id, func(c *chatIndex) { c.Enabled, c.Messages, c.words = false, nil, nil })
+			return textReplyf("🔎 Search is off and the %d kept messages are deleted.", n)
+		case len(args) == 2:
+			days, err := strconv.Atoi(args[1])
+			if err != nil || days < 0 {
+				break
+			}
+			searches.update(id, func(c *chatIndex) { c.KeepDays = days })
+			go searches.expire()
+			return textReplyf("Saved. 0 means messages are kept until search is turned off.")
+		}
+		return textReplyf("Usage: /search keep <days>")
+	}
+	if !enabled {
+		return textReplyf("🔎 Search is off here. Admins can turn it on with /search on.")
+	}
+	q, err := parseSearch(event)
+	if err != nil {
+		return textReplyf("🔎 %v.", err)
+	}
+	if len(q.Words) == 0 {
+		return textReplyf("🔎 Which words should I look for?")
+	}
+	found := searches.find(id, q)
+	if len(found) == 0 {
+		return textReplyf("🔎 Nothing found.")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔎 Best %d matches:", len(found))
+	for _, m := range found {
+		fmt.Fprintf(&b, "\n\n%s · %s\n%s", displayName(event.Source, m.UserID), m.Time.Format("2006-01-02"), snippet(m.Text, q.Words))
+	}
+	return textReplyf("%s", b.String())
+}
@@ -0,0 +1,136 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"The Picnic is on Saturday!", []string{"picnic", "saturday"}},
+		{"کتاب‌ها را به علي بده", []string{"کتابها", "علی", "بده"}},
+		{"كتاب ۱۴۰۳ و 2024", []string{"کتاب", "1403", "2024"}},
+		{"مَدرسه", []string{"مدرسه"}},
+		{"a b c", nil},
+	}
+	for _, tt := range tests {
+		if got := words(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("words(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := "We talked about many things today and at the very end somebody mentioned the picnic at the lake, which everybody liked a lot"
+	got := snippet(long, []string{"picnic"})
+	if !strings.HasPrefix(got, "…") || !strings.Contains(got, "picnic") || len([]rune(got)) > searchSnippet {
+		t.Errorf("snippet is %q", got)
+	}
+	if got := snippet("short text", []string{"missing"}); got != "short text" {
+		t.Errorf("snippet is %q", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	f := useFake(t)
+	f.profiles["U2"] = &linebot.UserProfileResponse{UserID: "U2", DisplayName: "Bob"}
+	resetSearches(nil)
+	defer func() {
+		resetSearches(nil)
+		admins.set("G1", "U1", false)
+	}()
+	bob := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: "U2"}
+	say := func(src *linebot.EventSource, id, text string, days int) {
+		event := textEvent(src, text)
+		event.Message.(*linebot.TextMessage).ID = id
+		event.Timestamp = time.Now().AddDate(0, 0, -days)
+		handleEvent(f, event)
+	}
+	run := func(text string, want string) {
+		t.Helper()
+		f.calls = nil
+		event := textEvent(inGroup, text)
+		if i := strings.Index(text, "@Bob"); i >= 0 {
+			event.Message.(*linebot.TextMessage).Mention = &linebot.Mention{Mentionees: []*linebot.Mentionee{{Index: i, Length: 4, UserID: "U2"}}}
+		}
+		handleEvent(f, event)
+		calls := f.Calls()
+		if len(calls) == 0 || !strings.Contains(calls[len(calls)-1], want) {
+			t.Errorf("%s: got %q, want a reply with %q", text, calls, want)
+		}
+	}
+
+	say(inGroup, "M0", "before anyone agreed to search", 0)
+	run("/search on", "Only admins")
+	admins.set("G1", "U1", true)
+	run("/search on", "Notice: from now on I keep the text of messages sent here for 90 days")
+	say(inGroup, "M1", "Shall we have a picnic at the lake?", 20)
+	say(bob, "M2", "Picnic sounds great, Saturday works", 10)
+	say(bob, "M3", "Picnics are the best", 1)
+	say(inGroup, "M4", "پیک‌نیک شنبه خوبه", 2)
+	say(inGroup, "M5", "/roll picnic", 0)
+	run("/search", "4 messages")
+	run("/search nothing", "Nothing found.")
+	run("/search picnic", "Best 3 matches:\n\nBob · "+time.Now().AddDate(0, 0, -10).Format("2006-01-02")+"\nPicnic sounds great")
+	run("/search picnic saturday", "Best 1 matches:\n\nBob")
+	run("/search from:@Bob picnic", "Best 2 matches:\n\nBob")
+	run("/search since:"+time.Now().AddDate(0, 0, -5).Format("2006-01-02")+" picnic", "Best 1 matches:\n\nBob")
+	run("/search since:yesterday picnic", "like 2026-10-01")
+	run("/search from: picnic", "mention the member")
+	run("/search پیکنیک", "Alice")
+
+	handleEvent(f, &linebot.Event{Type: linebot.EventTypeUnsend, Source: bob, Unsend: &linebot.Unsend{MessageID: "M3"}})
+	run("/search picnic", "Best 2 matches:\n\nBob")
+	f.calls = nil
+	handleEvent(f, textEvent(bob, "/search forget"))
+	checkCalls(t, f.Calls(), []string{"reply T: 🔎 Removed 1 of your messages"})
+	run("/search keep 0", "Saved.")
+	run("/search off", "deleted")
+	say(inGroup, "M6", "picnic again", 0)
+	run("/search picnic", "Search is off here.")
+	if _, _, n := searches.status("G1"); n != 0 {
+		t.Errorf("%d messages kept after /search off", n)
+	}
+}
+
+func TestSearchExpires(t *testing.T) {
+	resetSearches(map[string]*chatIndex{"G1": {Enabled: true, KeepDays: 7}})
+	defer resetSearches(nil)
+	searches.add("G1", indexedMessage{MessageID: "old", Time: time.Now().AddDate(0, 0, -8), Text: "old news"})
+	searches.add("G1", indexedMessage{MessageID: "new", Time: time.Now(), Text: "fresh news"})
+	searches.expire()
+	found := searches.find("G1", searchQuery{Words: []string{"news"}})
+	if len(found) != 1 || found[0].MessageID != "new" {
+		t.Errorf("found %+v", found)
+	}
+}
+
+// resetSearches replaces the search book, under its lock since /search keep
+// expires messages in the background.
+func resetSearches(chats map[string]*chatIndex) {
+	if chats == nil {
+		chats = map[string]*chatIndex{}
+	}
+	searches.mu.Lock()
+	defer searches.mu.Unlock()
+	searches.Chats = chats
+}
@@ -0,0 +1,325 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	topStickers       = 5
+	stickerSaveEvery  = time.Minute
+	stickerSummaryGap = 7 * 24 * time.Hour
+)
+
+// sendableStickerPackages are the sticker packages bots may send. Other
+// stickers are only counted; replying with them would fail the whole reply.
+var sendableStickerPackages = map[string]bool{
+	"446": true, "789": true, "1070": true, "6136": true, "6325": true,
+	"6359": true, "6362": true, "6370": true, "6632": true, "8515": true,
+	"8522": true, "8525": true, "11537": true, "11538": true, "11539": true,
+}
+
+func init() {
+	registerCommand("stickers", stickersCommand)
+	registerHelp("stickers", commandHelp{
+		Summary:    "Show the stickers used most here",
+		SummaryFa:  "آمار استیکرهای گروه",
+		Usage:      []string{"/stickers", "/stickers me"},
+		AdminUsage: []string{"/stickers weekly off"},
+		Where:      inShared,
+	})
+	registerSuggestions("stickers", func(event *linebot.Event, args []string) []linebot.QuickReplyAction {
+		return []linebot.QuickReplyAction{sendAction("My stickers", "/stickers me"), sendAction("All stickers", "/stickers")}
+	})
+	registerMessageHook(countStickers)
+}
+
+// useCounts counts stickers by "package/sticker" and LINE emojis by
+// "product/emoji".
+type useCounts struct {
+	Stickers map[string]int `json:"stickers,omitempty"`
+	Emojis   map[string]int `json:"emojis,omitempty"`
+}
+
+func (u *useCounts) add(sticker string, emojis []string) {
+	if sticker != "" {
+		if u.Stickers == nil {
+			u.Stickers = map[string]int{}
+		}
+		u.Stickers[sticker]++
+	}
+	for _, e := range emojis {
+		if u.Emojis == nil {
+			u.Emojis = map[string]int{}
+		}
+		u.Emojis[e]++
+	}
+}
+
+func (u useCounts) copy() useCounts {
+	return useCounts{Stickers: copyCounts(u.Stickers), Emojis: copyCounts(u.Emojis)}
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	if counts == nil {
+		return nil
+	}
+	c := make(map[string]int, len(counts))
+	for k, n := range counts {
+		c[k] = n
+	}
+	return c
+}
+
+func total(counts map[string]int) int {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+// top returns the keys of counts with the highest counts first.
+func top(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// chatStickers is the usage in one group or room, all time, per member and
+// since the last weekly summary.
+type chatStickers struct {
+	All         useCounts             `json:"all"`
+	Members     map[string]*useCounts `json:"members"`
+	Week        useCounts             `json:"week"`
+	NoSummary   bool                  `json:"noSummary,omitempty"`
+	LastSummary time.Time             `json:"lastSummary"`
+}
+
+// stickerStats holds the usage of every group and room.
+var stickerStats = &stickerBook{Chats: map[string]*chatStickers{}}
+
+type stickerBook struct {
+	mu    sync.RWMutex
+	saved time.Time
+	Chats map[string]*chatStickers `json:"chats"`
+}
+
+func (s *stickerBook) load() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := db.load("stickers", s); err != nil {
+		log.Print(err)
+	}
+}
+
+// get returns a copy of the usage of chat id.
+func (s *stickerBook) get(id string) chatStickers {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c := s.Chats[id]
+	if c == nil {
+		return chatStickers{}
+	}
+	copied := chatStickers{All: c.All.copy(), Week: c.Week.copy(), NoSummary: c.NoSummary, LastSummary: c.LastSummary, Members: map[string]*useCounts{}}
+	for userID, u := range c.Members {
+		u := u.copy()
+		copied.Members[userID] = &u
+	}
+	return copied
+}
+
+// update changes the usage of chat id with fn. Counts are saved at most once
+// a minute, settings at once.
+func (s *stickerBook) update(id string, now bool, fn func(c *chatStickers)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.Chats[id]
+	if c == nil {
+		c = &chatStickers{Members: map[string]*useCounts{}, LastSummary: time.Now()}
+		s.Chats[id] = c
+	}
+	fn(c)
+	if !now && time.Since(s.saved) < stickerSaveEvery {
+		return
+	}
+	s.saved = time.Now()
+	if err := db.save("stickers", s); err != nil {
+		log.Print(err)
+	}
+}
+
+// forgetChat resets the usage of chat id, keeping whether it wants weekly
+// summaries.
+func (s *stickerBook) forgetChat(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.Chats[id]
+	if c == nil {
+		return
+	}
+	s.Chats[id] = &chatStickers{Members: map[string]*useCounts{}, NoSummary: c.NoSummary, LastSummary: time.Now()}
+	if err := db.save("stickers", s); err != nil {
+		log.Print(err)
+	}
+}
+
+func countStickers(api botAPI, event *linebot.Event) {
+	var sticker string
+	var emojis []string
+	switch m := event.Message.(type) {
+	case *linebot.StickerMessage:
+		sticker = m.PackageID + "/" + m.StickerID
+	case *linebot.TextMessage:
+		for _, e := range m.Emojis {
+			emojis = append(emojis, e.ProductID+"/"+e.EmojiID)
+		}
+		if len(emojis) == 0 {
+			return
+		}
+	default:
+		return
+	}
+	stickerStats.update(sourceID(event.Source), false, func(c *chatStickers) {
+		c.All.add(sticker, emojis)
+		c.Week.add(sticker, emojis)
+		if c.Members[event.Source.UserID] == nil {
+			c.Members[event.Source.UserID] = &useCounts{}
+		}
+		c.Members[event.Source.UserID].add(sticker, emojis)
+	})
+}
+
+// stickerMessages reports usage as text followed by the top stickers that
+// can be sent, at most five messages in all.
+func stickerMessages(title string, u useCounts, fans string) []linebot.SendingMessage {
+	var b strings.Builder
+	b.WriteString(title + "\n")
+	var samples []linebot.SendingMessage
+	for i, k := range top(u.Stickers, topStickers) {
+		fmt.Fprintf(&b, "%d. sticker %s ×%d\n", i+1, k, u.Stickers[k])
+		parts := strings.SplitN(k, "/", 2)
+		if sendableStickerPackages[parts[0]] && len(samples) < 4 {
+			samples = append(samples, linebot.NewStickerMessage(parts[0], parts[1]))
+		}
+	}
+	fmt.Fprintf(&b, "\n😀 %d LINE emojis in %d kinds", total(u.Emojis), len(u.Emojis))
+	if fans != "" {
+		b.WriteString("\n" + fans)
+	}
+	return append([]linebot.SendingMessage{linebot.NewTextMessage(b.String())}, samples...)
+}
+
+// fans names the members who sent the most stickers and emojis. It looks up
+// names, so c must be a copy from stickerStats.get.
+func (c *chatStickers) fans(src *linebot.EventSource) string {
+	counts := map[string]int{}
+	for userID, u := range c.Members {
+		counts[userID] = total(u.Stickers) + total(u.Emojis)
+	}
+	var names []string
+	for _, userID := range top(counts, 3) {
+		names = append(names, fmt.Sprintf("%s (%d)", displayName(src, userID), counts[userID]))
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return "🏅 " + strings.Join(names, ", ")
+}
+
+func stickersCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	id := sourceID(event.Source)
+	sub := ""
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	var messages []linebot.SendingMessage
+	switch sub {
+	case "":
+		c := stickerStats.get(id)
+		if total(c.All.Stickers)+total(c.All.Emojis) == 0 {
+			return textReplyf("No stickers or LINE emojis have been sent here yet.")
+		}
+		messages = stickerMessages("🏷 Most used stickers here", c.All, c.fans(event.Source))
+	case "me":
+		c := stickerStats.get(id)
+		u := c.Members[event.Source.UserID]
+		if u == nil {
+			return textReplyf("You have not sent any stickers or LINE emojis here yet.")
+		}
+		messages = stickerMessages("🏷 Your most used stickers", *u, "")
+	case "weekly":
+		if len(args) < 2 || (args[1] != "on" && args[1] != "off") {
+			return textReplyf("Usage: /stickers weekly on|off")
+		}
+		if !isAdmin(event.Source) {
+			return textReplyf("Only admins can change the weekly summary.")
+		}
+		stickerStats.update(id, true, func(c *chatStickers) { c.NoSummary = args[1] == "off" })
+		return textReplyf("Weekly sticker summary turned %s.", args[1])
+	default:
+		return textReplyf("Usage: /stickers, /stickers me, /stickers weekly on|off")
+	}
+	return messages
+}
+
+// weeklyStickerSummaries pushes each chat's usage of the past week.
+func weeklyStickerSummaries() {
+	for {
+		scheduled("Weekly sticker summaries", time.Time{}, time.Now().Add(time.Hour))
+		time.Sleep(time.Hour)
+		type summary struct {
+			id       string
+			messages []linebot.SendingMessage
+		}
+		var due []summary
+		stickerStats.mu.Lock()
+		for id, c := range stickerStats.Chats {
+			if time.Since(c.LastSummary) < stickerSummaryGap {
+				continue
+			}
+			if !c.NoSummary && total(c.Week.Stickers)+total(c.Week.Emojis) > 0 {
+				due = append(due, summary{id, stickerMessages("📅 Stickers of the week", c.Week, "")})
+			}
+			c.Week = useCounts{}
+			c.LastSummary = time.Now()
+		}
+		if err := db.save("stickers", stickerStats); err != nil {
+			log.Print(err)
+		}
+		stickerStats.mu.Unlock()
+		for _, s := range due {
+			pushMessage(s.id, s.messages...)
+		}
+		scheduled("Weekly sticker summaries", time.Now(), time.Time{})
+	}
+}
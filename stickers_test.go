@@ -0,0 +1,47 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestStickersCommand(t *testing.T) {
+	f := useFake(t)
+	f.profiles["U2"] = &linebot.UserProfileResponse{UserID: "U2", DisplayName: "Bob"}
+	stickerStats.Chats = map[string]*chatStickers{}
+	defer func() { stickerStats.Chats = map[string]*chatStickers{} }()
+	bob := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "G1", UserID: "U2"}
+	send := func(src *linebot.EventSource, sticker string) {
+		handleEvent(f, &linebot.Event{Type: linebot.EventTypeMessage, ReplyToken: "T", Source: src, Message: &linebot.StickerMessage{ID: "M1", PackageID: "446", StickerID: sticker}})
+	}
+
+	f.calls = nil
+	handleEvent(f, textEvent(inGroup, "/stickers"))
+	checkCalls(t, f.Calls(), []string{"reply T: No stickers or LINE emojis have been sent here yet."})
+
+	send(bob, "1988")
+	send(bob, "1988")
+	send(inGroup, "1989")
+	f.calls = nil
+	handleEvent(f, textEvent(inGroup, "/stickers"))
+	calls := f.Calls()
+	checkCalls(t, calls[len(calls)-1:], []string{"1. sticker 446/1988 ×2\n2. sticker 446/1989 ×1"})
+	checkCalls(t, calls[len(calls)-1:], []string{"🏅 Bob (2), Alice (1)"})
+
+	f.calls = nil
+	handleEvent(f, textEvent(bob, "/stickers me"))
+	checkCalls(t, f.Calls(), []string{"reply T: 🏷 Your most used stickers\n1. sticker 446/1988 ×2"})
+}
@@ -0,0 +1,254 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Channels with a channel ID, assertion key ID and private key get short
+// lived channel access tokens (v2.1) instead of a long-lived one. A token is
+// renewed when a fifth of its lifetime is left, and the old one revoked.
+
+const (
+	defaultTokenHours = 24
+	maxTokenHours     = 30 * 24
+	tokenRetry        = time.Minute
+)
+
+// issuedToken is a channel access token and when it expires.
+type issuedToken struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// tokens keeps the issued tokens of every channel, so that a restart reuses
+// them rather than issuing more (a channel may have at most 30).
+var tokens = &tokenBook{Channels: map[string]*issuedToken{}}
+
+type tokenBook struct {
+	mu       sync.Mutex
+	Channels map[string]*issuedToken `json:"channels"`
+}
+
+func (b *tokenBook) load() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := db.load("tokens", b); err != nil {
+		log.Print(err)
+	}
+}
+
+func (b *tokenBook) get(name string) issuedToken {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t := b.Channels[name]; t != nil {
+		return *t
+	}
+	return issuedToken{}
+}
+
+func (b *tokenBook) set(name string, t issuedToken) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Channels[name] = &t
+	if err := db.save("tokens", b); err != nil {
+		log.Print(err)
+	}
+}
+
+// tokenTransport sends the channel's current token with every request, so
+// that a renewed token takes effect without a new client.
+type tokenTransport struct {
+	name string
+	base http.RoundTripper
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+tokens.get(t.name).Token)
+	return t.base.RoundTrip(req)
+}
+
+// rotates tells whether the channel uses short-lived tokens.
+func (c *channel) rotates() bool {
+	return c.ChannelID != "" && c.PrivateKey != ""
+}
+
+// accessToken is the token the channel currently sends to LINE.
+func (c *channel) accessToken() string {
+	if c.rotates() {
+		return tokens.get(c.Name).Token
+	}
+	return c.Token
+}
+
+// rotatingClient is a client whose token comes from tokens.
+func (c *channel) rotatingClient() (*linebot.Client, error) {
+	if c.TokenHours == 0 {
+		c.TokenHours = defaultTokenHours
+	}
+	if c.TokenHours < 1 || c.TokenHours > maxTokenHours {
+		return nil, fmt.Errorf("tokenHours must be 1-%d", maxTokenHours)
+	}
+	key, err := loadPrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	c.key = key
+	// The token given to New is never sent; tokenTransport replaces it.
+	return linebot.New(c.Secret, "rotating", linebot.WithHTTPClient(&http.Client{
+		Transport: tokenTransport{c.Name, http.DefaultTransport},
+	}))
+}
+
+// loadPrivateKey reads an RSA private key as PEM (PKCS #1 or #8) or as the
+// JWK that the LINE Developers console instructions generate.
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, fmt.Errorf("%s: not an RSA key", path)
+	}
+	var jwk struct {
+		Kty, N, E, D, P, Q string
+	}
+	if err := json.Unmarshal(b, &jwk); err != nil || jwk.Kty != "RSA" {
+		return nil, fmt.Errorf("%s: neither a PEM nor an RSA JWK private key", path)
+	}
+	var n [5]*big.Int
+	for i, s := range []string{jwk.N, jwk.E, jwk.D, jwk.P, jwk.Q} {
+		v, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(v) == 0 {
+			return nil, fmt.Errorf("%s: bad or missing RSA key parameter", path)
+		}
+		n[i] = new(big.Int).SetBytes(v)
+	}
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: n[0], E: int(n[1].Int64())},
+		D:         n[2],
+		Primes:    []*big.Int{n[3], n[4]},
+	}
+	if err := key.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	key.Precompute()
+	return key, nil
+}
+
+// assertion is the JWT that proves the bot holds the channel's private key.
+func (c *channel) assertion() (string, error) {
+	enc := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	header := map[string]string{"alg": "RS256", "typ": "JWT", "kid": c.KeyID}
+	claims := map[string]interface{}{
+		"iss":       c.ChannelID,
+		"sub":       c.ChannelID,
+		"aud":       "https://api.line.me/",
+		"exp":       time.Now().Add(30 * time.Minute).Unix(),
+		"token_exp": c.TokenHours * 3600,
+	}
+	signed := enc(header) + "." + enc(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// renewToken issues a new token if the current one is missing or due, and
+// revokes the one it replaces. It returns when the token is next due.
+func (c *channel) renewToken() (time.Time, error) {
+	old := tokens.get(c.Name)
+	lifetime := time.Duration(c.TokenHours) * time.Hour
+	if due := old.Expires.Add(-lifetime / 5); old.Token != "" && time.Now().Before(due) {
+		return due, nil
+	}
+	jwt, err := c.assertion()
+	if err != nil {
+		return time.Time{}, err
+	}
+	res, err := c.client.IssueAccessTokenV2(jwt).Do()
+	if err != nil {
+		return time.Time{}, err
+	}
+	issued := issuedToken{res.AccessToken, time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)}
+	tokens.set(c.Name, issued)
+	log.Printf("Channel %s: new access token, valid until %s", c.Name, issued.Expires.Format(time.RFC3339))
+	if old.Token != "" && time.Now().Before(old.Expires) {
+		if _, err := c.client.RevokeAccessTokenV2(c.ChannelID, c.Secret, old.Token).Do(); err != nil {
+			log.Printf("Channel %s: revoking the old token: %v", c.Name, err)
+		}
+	}
+	return issued.Expires.Add(-time.Duration(res.ExpiresIn) * time.Second / 5), nil
+}
+
+// issueTokens makes sure every rotating channel has a usable token.
+func issueTokens() error {
+	tokens.load()
+	for _, c := range channels {
+		if !c.rotates() {
+			continue
+		}
+		if _, err := c.renewToken(); err != nil {
+			return fmt.Errorf("channel %s: issuing an access token: %v", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// renewTokens keeps the token of a rotating channel fresh.
+func renewTokens(c *channel) {
+	for {
+		due, err := c.renewToken()
+		if err != nil {
+			log.Printf("Channel %s: renewing the access token: %v", c.Name, err)
+		}
+		if time.Until(due) < tokenRetry {
+			due = time.Now().Add(tokenRetry)
+		}
+		scheduled("Token renewal: "+c.Name, time.Now(), due)
+		time.Sleep(time.Until(due))
+	}
+}
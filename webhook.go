@@ -0,0 +1,148 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const webhookUsage = `usage:
+  webhook             show the endpoint and whether it is active
+  webhook set [url]   set the endpoint, by default WebhookURL or PublicURL/callback
+  webhook test        have LINE send a test request to the endpoint`
+
+// webhookURL is the endpoint this deployment expects LINE to call for c.
+func webhookURL(c *channel) string {
+	if u := os.Getenv("WebhookURL"); u != "" && c == defaultChannel {
+		return u
+	}
+	if publicURL == "" {
+		return ""
+	}
+	u := strings.TrimSuffix(publicURL, "/") + "/callback"
+	if c != defaultChannel {
+		u += "/" + c.Name
+	}
+	return u
+}
+
+// webhookInfoURL is where LINE reports the webhook endpoint of a channel.
+var webhookInfoURL = linebot.APIEndpointBase + linebot.APIEndpointGetWebhookInfo
+
+type webhookInfo struct {
+	Endpoint string `json:"endpoint"`
+	Active   bool   `json:"active"`
+}
+
+// getWebhookInfo asks LINE for the webhook endpoint. The SDK's GetWebhookInfo
+// expects "active" to be a string, but the API sends a boolean.
+func getWebhookInfo(c *channel) (*webhookInfo, error) {
+	req, err := http.NewRequest("GET", webhookInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.accessToken())
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webhook info: %s", res.Status)
+	}
+	var info webhookInfo
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func webhookCLI(args []string) error {
+	if len(args) == 0 {
+		info, err := getWebhookInfo(cliChannel)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("endpoint: %s\nactive:   %v\n", info.Endpoint, info.Active)
+		if want := webhookURL(cliChannel); want != "" && want != info.Endpoint {
+			fmt.Printf("expected: %s\n", want)
+		}
+		return nil
+	}
+	switch args[0] {
+	case "set":
+		u := webhookURL(cliChannel)
+		if len(args) > 1 {
+			u = args[1]
+		}
+		if u == "" {
+			return errors.New("no URL given and neither WebhookURL nor PublicURL is set")
+		}
+		if _, err := bot.SetWebhookEndpointURL(u).Do(); err != nil {
+			return err
+		}
+		fmt.Printf("endpoint set to %s\n", u)
+		return nil
+	case "test":
+		res, err := bot.TestWebhook().Do()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("success: %v\nstatus:  %d %s\n", res.Success, res.StatusCode, res.Reason)
+		if res.Detail != "" {
+			fmt.Printf("detail:  %s\n", res.Detail)
+		}
+		if !res.Success {
+			return errors.New("webhook test failed")
+		}
+		return nil
+	}
+	return errors.New(webhookUsage)
+}
+
+// verifyWebhook warns when LINE is not set to call this deployment. It runs
+// once the server is up, with VerifyWebhook=true.
+func verifyWebhook() {
+	time.Sleep(time.Second)
+	for _, c := range channels {
+		want := webhookURL(c)
+		if want == "" {
+			log.Print("VerifyWebhook: set WebhookURL or PublicURL to compare the endpoint with")
+			return
+		}
+		log.Print(checkWebhook(c, want))
+	}
+}
+
+// checkWebhook compares the endpoint LINE calls for c with want.
+func checkWebhook(c *channel, want string) string {
+	info, err := getWebhookInfo(c)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("VerifyWebhook %s: %v", c.Name, err)
+	case info.Endpoint != want:
+		return fmt.Sprintf("WARNING: the webhook endpoint of channel %s is %q, not this deployment (%q). Run \"webhook set\" to fix it.", c.Name, info.Endpoint, want)
+	case !info.Active:
+		return fmt.Sprintf("WARNING: the webhook endpoint %q of channel %s is not active.", want, c.Name)
+	}
+	return fmt.Sprintf("Webhook endpoint %q of channel %s is active.", want, c.Name)
+}
@@ -0,0 +1,90 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWebhookURL(t *testing.T) {
+	useFake(t)
+	other := &channel{Name: "shop"}
+	channels["shop"] = other
+	defer func() {
+		publicURL = ""
+		os.Unsetenv("WebhookURL")
+	}()
+
+	tests := []struct {
+		publicURL, webhookURL string
+		c                     *channel
+		want                  string
+	}{
+		{"", "", defaultChannel, ""},
+		{"https://bot.example", "", defaultChannel, "https://bot.example/callback"},
+		{"https://bot.example/", "", defaultChannel, "https://bot.example/callback"},
+		{"https://bot.example/", "", other, "https://bot.example/callback/shop"},
+		{"https://bot.example", "https://hooks.example/line", defaultChannel, "https://hooks.example/line"},
+		{"https://bot.example", "https://hooks.example/line", other, "https://bot.example/callback/shop"},
+		{"", "https://hooks.example/line", other, ""},
+	}
+	for _, tt := range tests {
+		publicURL = tt.publicURL
+		os.Setenv("WebhookURL", tt.webhookURL)
+		if got := webhookURL(tt.c); got != tt.want {
+			t.Errorf("PublicURL %q, WebhookURL %q, channel %s: got %q, want %q", tt.publicURL, tt.webhookURL, tt.c.Name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckWebhook(t *testing.T) {
+	// Each channel's token gets its own endpoint back.
+	endpoints := map[string]string{
+		"Bearer same":     `{"endpoint": "https://bot.example/callback", "active": true}`,
+		"Bearer other":    `{"endpoint": "https://old.example/callback", "active": true}`,
+		"Bearer inactive": `{"endpoint": "https://bot.example/callback", "active": false}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := endpoints[r.Header.Get("Authorization")]
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+	old := webhookInfoURL
+	webhookInfoURL = srv.URL
+	defer func() { webhookInfoURL = old }()
+
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"same", `Webhook endpoint "https://bot.example/callback" of channel test is active.`},
+		{"other", `WARNING: the webhook endpoint of channel test is "https://old.example/callback", not this deployment ("https://bot.example/callback").`},
+		{"inactive", `WARNING: the webhook endpoint "https://bot.example/callback" of channel test is not active.`},
+		{"revoked", "VerifyWebhook test: webhook info: 401 Unauthorized"},
+	}
+	for _, tt := range tests {
+		c := &channel{Name: "test", Token: tt.token}
+		if got := checkWebhook(c, "https://bot.example/callback"); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("token %s: got %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Werewolf is played in a group: players /join a lobby, get their roles in a
+// one-on-one chat, act at night with postback buttons sent to them privately
+// and vote during the day with buttons in the group.
+
+const (
+	wwMinPlayers = 4
+	wwMaxPlayers = 13 // one quick reply button per player
+	wwNightTime  = 90 * time.Second
+	wwDayTime    = 3 * time.Minute
+)
+
+type wwRole string
+
+const (
+	roleVillager wwRole = "villager"
+	roleWerewolf wwRole = "werewolf"
+	roleSeer     wwRole = "seer"
+	roleDoctor   wwRole = "doctor"
+)
+
+var wwRoleInfo = map[wwRole]string{
+	roleVillager: "🧑‍🌾 You are a Villager. Find the werewolves and vote them out during the day.",
+	roleWerewolf: "🐺 You are a Werewolf. Each night, choose a villager to eat. Don't get caught!",
+	roleSeer:     "🔮 You are the Seer. Each night, choose a player to learn whether they are a werewolf.",
+	roleDoctor:   "💉 You are the Doctor. Each night, choose a player to protect from the werewolves.",
+}
+
+func init() {
+	registerCommand("werewolf", werewolfCommand)
+	registerCommand("join", joinWerewolfCommand)
+	registerHelp("werewolf", commandHelp{
+		Summary:   "Play werewolf",
+		SummaryFa: "بازی گرگینه",
+		Usage:     []string{"/werewolf new", "/werewolf roles werewolf=2 seer=1 doctor=1", "/werewolf start", "/werewolf stop"},
+		Where:     inShared,
+	})
+	registerHelp("join", commandHelp{
+		Summary:   "Join the werewolf game",
+		SummaryFa: "پیوستن به بازی گرگینه",
+		Usage:     []string{"/join"},
+		Where:     inShared,
+	})
+	registerPostback("ww", werewolfPostback)
+	registerSuggestions("werewolf", func(event *linebot.Event, args []string) []linebot.QuickReplyAction {
+		if len(args) == 0 || !strings.EqualFold(args[0], "new") {
+			return nil
+		}
+		return werewolfSetupActions()
+	})
+	registerSuggestions("join", func(event *linebot.Event, args []string) []linebot.QuickReplyAction {
+		return werewolfSetupActions()
+	})
+}
+
+// werewolfSetupActions offer to join or start a game being set up.
+func werewolfSetupActions() []linebot.QuickReplyAction {
+	return []linebot.QuickReplyAction{sendAction("🙋 Join", "/join"), sendAction("▶️ Start", "/werewolf start")}
+}
+
+type wwPlayer struct {
+	userID string
+	name   string
+	role   wwRole
+	alive  bool
+}
+
+// wwGame is a lobby or running game in one group or room. Phase counts the
+// nights and days; buttons from an earlier phase are ignored.
+type wwGame struct {
+	source  linebot.EventSource
+	players []*wwPlayer
+	roles   map[wwRole]int
+	started bool
+	night   bool
+	phase   int
+	kills   map[string]string
+	protect string
+	acted   map[string]bool
+	votes   map[string]string
+	timer   *time.Timer
+}
+
+var werewolves = struct {
+	sync.Mutex
+	games map[string]*wwGame
+}{games: map[string]*wwGame{}}
+
+// wwPush is a message the game sends once the lock is released.
+type wwPush struct {
+	to       string
+	messages []linebot.SendingMessage
+}
+
+func sendPushes(pushes []wwPush) {
+	for _, p := range pushes {
+		pushMessage(p.to, p.messages...)
+	}
+}
+
+func werewolfCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	if event.Source.GroupID == "" && event.Source.RoomID == "" {
+		return textReplyf("Werewolf is played in a group or room.")
+	}
+	sub := ""
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	id := sourceID(event.Source)
+	switch sub {
+	case "new":
+		werewolves.Lock()
+		defer werewolves.Unlock()
+		if werewolves.games[id] != nil {
+			return textReplyf("A game already exists here. /werewolf stop ends it.")
+		}
+		werewolves.games[id] = &wwGame{source: *event.Source}
+		return textReplyf("🐺 A new Werewolf game is open! Type /join to play, then /werewolf start.\nAdd me as a friend first so I can tell you your role.")
+	case "roles":
+		return setWerewolfRoles(id, args[1:])
+	case "start":
+		return startWerewolf(event.Source)
+	case "stop":
+		werewolves.Lock()
+		defer werewolves.Unlock()
+		game := werewolves.games[id]
+		if game == nil {
+			return textReplyf("No Werewolf game here.")
+		}
+		if game.timer != nil {
+			game.timer.Stop()
+		}
+		delete(werewolves.games, id)
+		return textReplyf("Game stopped.\n%s", game.reveal())
+	case "", "status":
+		werewolves.Lock()
+		defer werewolves.Unlock()
+		game := werewolves.games[id]
+		if game == nil {
+			return textReplyf("Usage: /werewolf new, /join, /werewolf roles werewolf=2 seer=1 doctor=1, /werewolf start, /werewolf stop")
+		}
+		return textReplyf("%s", game.status())
+	}
+	return textReplyf("Usage: /werewolf new, /join, /werewolf roles werewolf=2 seer=1 doctor=1, /werewolf start, /werewolf stop")
+}
+
+// setWerewolfRoles configures the special roles of a lobby, e.g.
+// "werewolf=2 seer=1 doctor=0". Everyone else is a villager.
+func setWerewolfRoles(id string, args []string) []linebot.SendingMessage {
+	roles := map[wwRole]int{}
+	for _, arg := range args {
+		name, count := arg, 1
+		if i := strings.Index(arg, "="); i >= 0 {
+			n, err := strconv.Atoi(arg[i+1:])
+			if err != nil || n < 0 || n > wwMaxPlayers {
+				return textReplyf("Bad role count %q.", arg)
+			}
+			name, count = arg[:i], n
+		}
+		role := wwRole(strings.ToLower(name))
+		if _, ok := wwRoleInfo[role]; !ok || role == roleVillager {
+			return textReplyf("Unknown role %q. Roles: werewolf, seer, doctor.", name)
+		}
+		roles[role] = count
+	}
+	if roles[roleWerewolf] < 1 {
+		return textReplyf("There must be at least one werewolf.")
+	}
+	werewolves.Lock()
+	defer werewolves.Unlock()
+	game := werewolves.games[id]
+	if game == nil || game.started {
+		return textReplyf("Roles can only be set in an open lobby. /werewolf new opens one.")
+	}
+	game.roles = roles
+	return textReplyf("Roles set: %s", formatRoles(roles))
+}
+
+func formatRoles(roles map[wwRole]int) string {
+	var parts []string
+	for _, role := range []wwRole{roleWerewolf, roleSeer, roleDoctor} {
+		if roles[role] > 0 {
+			parts = append(parts, fmt.Sprintf("%s×%d", role, roles[role]))
+		}
+	}
+	return strings.Join(parts, ", ") + ", the rest villagers"
+}
+
+// defaultRoles is one werewolf per four players, plus a seer and, from five
+// players on, a doctor.
+func defaultRoles(players int) map[wwRole]int {
+	roles := map[wwRole]int{roleWerewolf: players / 4, roleSeer: 1}
+	if roles[roleWerewolf] < 1 {
+		roles[roleWerewolf] = 1
+	}
+	if players >= 5 {
+		roles[roleDoctor] = 1
+	}
+	return roles
+}
+
+func joinWerewolfCommand(event *linebot.Event, args []string) []linebot.SendingMessage {
+	id := sourceID(event.Source)
+	if id == event.Source.UserID {
+		return textReplyf("Type /join in the group where the game is open.")
+	}
+	// Roles and night actions are sent privately, which only works for
+	// users who have added the bot as a friend.
+	profile, err := botFor(event.Source).GetProfile(event.Source.UserID)
+	if err != nil {
+		return textReplyf("%s, please add me as a friend first so I can send you your role, then /join again.", displayName(event.Source, event.Source.UserID))
+	}
+
+	werewolves.Lock()
+	defer werewolves.Unlock()
+	game := werewolves.games[id]
+	switch {
+	case game == nil:
+		return textReplyf("No game is open. /werewolf new opens one.")
+	case game.started:
+		return textReplyf("The game has already started.")
+	case game.player(event.Source.UserID) != nil:
+		return textReplyf("%s, you have already joined.", profile.DisplayName)
+	case len(game.players) >= wwMaxPlayers:
+		return textReplyf("The game is full (%d players).", wwMaxPlayers)
+	}
+	game.players = append(game.players, &wwPlayer{userID: event.Source.UserID, name: profile.DisplayName, alive: true})
+	return textReplyf("✋ %s joined (%d players).", profile.DisplayName, len(game.players))
+}
+
+func startWerewolf(src *linebot.EventSource) []linebot.SendingMessage {
+	id := sourceID(src)
+	werewolves.Lock()
+	game := werewolves.games[id]
+	if game == nil || game.started {
+		werewolves.Unlock()
+		return textReplyf("No open lobby. /werewolf new opens one.")
+	}
+	var userIDs []string
+	for _, p := range game.players {
+		userIDs = append(userIDs, p.userID)
+	}
+	werewolves.Unlock()
+
+	// Players may have blocked the bot since joining.
+	unreachable := map[string]bool{}
+	for _, userID := range userIDs {
+		if _, err := clientFor(id).GetProfile(userID); err != nil {
+			unreachable[userID] = true
+		}
+	}
+
+	werewolves.Lock()
+	if werewolves.games[id] != game || game.started {
+		werewolves.Unlock()
+		return nil
+	}
+	var dropped []string
+	players := game.players[:0]
+	for _, p := range game.players {
+		if unreachable[p.userID] {
+			dropped = append(dropped, p.name)
+			continue
+		}
+		players = append(players, p)
+	}
+	game.players = players
+	var notes []string
+	if len(dropped) > 0 {
+		notes = append(notes, fmt.Sprintf("I can't message %s, so they were removed. Add me as a friend and /join again.", strings.Join(dropped, ", ")))
+	}
+	roles := game.roles
+	if roles == nil {
+		roles = defaultRoles(len(game.players))
+	}
+	// Each count is capped at the players, so that the sum cannot overflow.
+	specials := 0
+	for _, n := range roles {
+		if n > len(game.players) {
+			n = len(game.players)
+		}
+		specials += n
+	}
+	if len(game.players) < wwMinPlayers || specials >= len(game.players) {
+		werewolves.Unlock()
+		notes = append(notes, fmt.Sprintf("Not enough players: %d joined, at least %d needed and more than the %d special roles.", len(game.players), wwMinPlayers, specials))
+		return textReplyf("%s", strings.Join(notes, "\n"))
+	}
+
+	deck := make([]wwRole, 0, len(game.players))
+	for _, role := range []wwRole{roleWerewolf, roleSeer, roleDoctor} {
+		for i := 0; i < roles[role]; i++ {
+			deck = append(deck, role)
+		}
+	}
+	for len(deck) < len(game.players) {
+		deck = append(deck, roleVillager)
+	}
+	rand.Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+	var pushes []wwPush
+	for i, p := range game.players {
+		p.role = deck[i]
+		pushes = append(pushes, wwPush{p.userID, []linebot.SendingMessage{linebot.NewTextMessage(wwRoleInfo[p.role])}})
+	}
+	game.started = true
+	notes = append(notes, fmt.Sprintf("🌕 The game begins with %d players (%s). Check your private chat with me for your role.", len(game.players), formatRoles(roles)))
+	pushes = append(pushes, game.beginNight(id)...)
+	werewolves.Unlock()
+
+	sendPushes(pushes)
+	return textReplyf("%s", strings.Join(notes, "\n"))
+}
+
+func (g *wwGame) player(userID string) *wwPlayer {
+	for _, p := range g.players {
+		if p.userID == userID {
+			return p
+		}
+	}
+	return nil
+}
+
+func (g *wwGame) alive() []*wwPlayer {
+	var alive []*wwPlayer
+	for _, p := range g.players {
+		if p.alive {
+			alive = append(alive, p)
+		}
+	}
+	return alive
+}
+
+// targetButtons offers the living players, except skip, as postback buttons.
+func (g *wwGame) targetButtons(id, op, skip string) *linebot.QuickReplyItems {
+	var actions []linebot.QuickReplyAction
+	for _, p := range g.alive() {
+		if p.userID == skip {
+			continue
+		}
+		data := url.Values{"a": {"ww"}, "op": {op}, "g": {id}, "p": {strconv.Itoa(g.phase)}, "t": {p.userID}}
+		actions = append(actions, linebot.NewPostbackAction(quickReplyLabel(p.name), data.Encode(), "", p.name))
+	}
+	return quickReplyItems(actions...)
+}
+
+// beginNight asks every living werewolf, seer and doctor to act. The caller
+// holds the werewolves lock.
+func (g *wwGame) beginNight(id string) []wwPush {
+	g.phase++
+	g.night = true
+	g.kills = map[string]string{}
+	g.protect = ""
+	g.acted = map[string]bool{}
+	var pushes []wwPush
+	for _, p := range g.alive() {
+		var prompt string
+		var buttons *linebot.QuickReplyItems
+		switch p.role {
+		case roleWerewolf:
+			prompt, buttons = "🐺 Who will you eat tonight?", g.targetButtons(id, "kill", p.userID)
+		case roleSeer:
+			prompt, buttons = "🔮 Whose role will you see tonight?", g.targetButtons(id, "see", p.userID)
+		case roleDoctor:
+			prompt, buttons = "💉 Whom will you protect tonight?", g.targetButtons(id, "save", "")
+		default:
+			continue
+		}
+		pushes = append(pushes, wwPush{p.userID, []linebot.SendingMessage{linebot.NewTextMessage(prompt).WithQuickReplies(buttons)}})
+	}
+	pushes = append(pushes, wwPush{id, []linebot.SendingMessage{linebot.NewTextMessage(fmt.Sprintf("🌙 Night %d falls. Werewolves, seer and doctor: check your private chat with me.", (g.phase+1)/2))}})
+	g.schedule(id, wwNightTime)
+	return pushes
+}
+
+func (g *wwGame) schedule(id string, d time.Duration) {
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	phase := g.phase
+	g.timer = time.AfterFunc(d, func() {
+		werewolves.Lock()
+		var pushes []wwPush
+		if werewolves.games[id] == g && g.phase == phase {
+			pushes = g.advance(id)
+		}
+		werewolves.Unlock()
+		sendPushes(pushes)
+	})
+}
+
+// nightDone reports whether every living night role has acted.
+func (g *wwGame) nightDone() bool {
+	for _, p := range g.alive() {
+		if p.role != roleVillager && !g.acted[p.userID] {
+			return false
+		}
+	}
+	return true
+}
+
+// advance ends the current night or day. The caller holds the werewolves lock.
+func (g *wwGame) advance(id string) []wwPush {
+	var news string
+	if g.night {
+		victim := plurality(g.kills, true)
+		switch {
+		case victim == "":
+			news = "☀️ Morning comes. The werewolves did not strike."
+		case victim == g.protect:
+			news = "☀️ Morning comes. The doctor saved this night's victim!"
+		default:
+			p := g.player(victim)
+			p.alive = false
+			news = fmt.Sprintf("☀️ Morning comes. %s was eaten by werewolves.", p.name)
+		}
+	} else {
+		lynched := plurality(g.votes, false)
+		if lynched == "" {
+			news = "🌆 The village could not agree. Nobody was hanged."
+		} else {
+			p := g.player(lynched)
+			p.alive = false
+			news = fmt.Sprintf("🌆 The village hanged %s, who was a %s.", p.name, p.role)
+		}
+	}
+
+	if winner := g.winner(); winner != "" {
+		delete(werewolves.games, id)
+		return []wwPush{{id, []linebot.SendingMessage{linebot.NewTextMessage(news + "\n\n" + winner + "\n" + g.reveal())}}}
+	}
+	if !g.night {
+		return append([]wwPush{{id, []linebot.SendingMessage{linebot.NewTextMessage(news)}}}, g.beginNight(id)...)
+	}
+
+	g.phase++
+	g.night = false
+	g.votes = map[string]string{}
+	g.schedule(id, wwDayTime)
+	prompt := fmt.Sprintf("%s\n\n🗳 Discuss and vote for who to hang. You have %d minutes.", news, int(wwDayTime/time.Minute))
+	return []wwPush{{id, []linebot.SendingMessage{linebot.NewTextMessage(prompt).WithQuickReplies(g.targetButtons(id, "vote", ""))}}}
+}
+
+// plurality returns the most chosen target. Ties are broken at random when
+// breakTies is set and leave no target otherwise.
+func plurality(choices map[string]string, breakTies bool) string {
+	counts := map[string]int{}
+	for _, target := range choices {
+		counts[target]++
+	}
+	var best []string
+	most := 0
+	for target, n := range counts {
+		switch {
+		case n > most:
+			best, most = []string{target}, n
+		case n == most:
+			best = append(best, target)
+		}
+	}
+	switch {
+	case len(best) == 1:
+		return best[0]
+	case len(best) > 1 && breakTies:
+		sort.Strings(best)
+		return best[rand.Intn(len(best))]
+	}
+	return ""
+}
+
+// winner announces the winning side, if the game is over.
+func (g *wwGame) winner() string {
+	wolves, others := 0, 0
+	for _, p := range g.alive() {
+		if p.role == roleWerewolf {
+			wolves++
+		} else {
+			others++
+		}
+	}
+	switch {
+	case wolves == 0:
+		return "🎉 All werewolves are dead. The village wins!"
+	case wolves >= others:
+		return "🐺 The werewolves outnumber the village. The werewolves win!"
+	}
+	return ""
+}
+
+func (g *wwGame) reveal() string {
+	var b strings.Builder
+	for _, p := range g.players {
+		mark := ""
+		if !p.alive {
+			mark = " ☠️"
+		}
+		role := string(p.role)
+		if role == "" {
+			role = "-"
+		}
+		fmt.Fprintf(&b, "%s: %s%s\n", p.name, role, mark)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (g *wwGame) status() string {
+	if !g.started {
+		var names []string
+		for _, p := range g.players {
+			names = append(names, p.name)
+		}
+		return fmt.Sprintf("Lobby with %d players: %s", len(names), strings.Join(names, ", "))
+	}
+	var names []string
+	for _, p := range g.alive() {
+		names = append(names, p.name)
+	}
+	when := "Day"
+	if g.night {
+		when = "Night"
+	}
+	return fmt.Sprintf("%s %d. Alive: %s", when, (g.phase+1)/2, strings.Join(names, ", "))
+}
+
+// werewolfPostback records a night action or a day vote.
+func werewolfPostback(event *linebot.Event, data url.Values) []linebot.SendingMessage {
+	id, op, target := data.Get("g"), data.Get("op"), data.Get("t")
+	phase, _ := strconv.Atoi(data.Get("p"))
+	userID := event.Source.UserID
+
+	werewolves.Lock()
+	game := werewolves.games[id]
+	if game == nil || !game.started || game.phase != phase {
+		werewolves.Unlock()
+		return textReplyf("That choice is no longer open.")
+	}
+	actor, victim := game.player(userID), game.player(target)
+	if actor == nil || !actor.alive || victim == nil || !victim.alive {
+		werewolves.Unlock()
+		return textReplyf("You can't do that.")
+	}
+
+	var reply string
+	switch {
+	case op == "vote" && !game.night:
+		game.votes[userID] = target
+		reply = fmt.Sprintf("🗳 %s votes for %s.", actor.name, victim.name)
+		if len(game.votes) < len(game.alive()) {
+			werewolves.Unlock()
+			return textReplyf("%s", reply)
+		}
+	case !game.night || game.acted[userID]:
+		werewolves.Unlock()
+		return textReplyf("You have already acted tonight.")
+	case op == "kill" && actor.role == roleWerewolf:
+		game.kills[userID] = target
+		reply = fmt.Sprintf("🐺 You chose %s.", victim.name)
+	case op == "see" && actor.role == roleSeer:
+		verdict := "not a werewolf"
+		if victim.role == roleWerewolf {
+			verdict = "a werewolf!"
+		}
+		reply = fmt.Sprintf("🔮 %s is %s", victim.name, verdict)
+	case op == "save" && actor.role == roleDoctor:
+		game.protect = target
+		reply = fmt.Sprintf("💉 You protect %s tonight.", victim.name)
+	default:
+		werewolves.Unlock()
+		return textReplyf("You can't do that.")
+	}
+	var pushes []wwPush
+	if game.night {
+		game.acted[userID] = true
+		if game.nightDone() {
+			pushes = game.advance(id)
+		}
+	} else {
+		pushes = game.advance(id)
+	}
+	werewolves.Unlock()
+
+	sendPushes(pushes)
+	return textReplyf("%s", reply)
+}
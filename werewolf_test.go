@@ -0,0 +1,153 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// openWerewolf opens a lobby in G1 with players U1 to Un.
+func openWerewolf(t *testing.T, f *fakeAPI, n int) *wwGame {
+	t.Helper()
+	game := &wwGame{source: *inGroup}
+	for i := 1; i <= n; i++ {
+		userID := fmt.Sprintf("U%d", i)
+		if f.profiles[userID] == nil {
+			f.profiles[userID] = &linebot.UserProfileResponse{UserID: userID, DisplayName: "Player " + userID}
+		}
+		game.players = append(game.players, &wwPlayer{userID: userID, name: f.profiles[userID].DisplayName, alive: true})
+	}
+	werewolves.Lock()
+	werewolves.games["G1"] = game
+	werewolves.Unlock()
+	t.Cleanup(func() {
+		werewolves.Lock()
+		if game.timer != nil {
+			game.timer.Stop()
+		}
+		delete(werewolves.games, "G1")
+		werewolves.Unlock()
+	})
+	return game
+}
+
+func TestSetWerewolfRoles(t *testing.T) {
+	f := useFake(t)
+	openWerewolf(t, f, 4)
+	tests := []struct {
+		args string
+		want string
+	}{
+		{"werewolf=2 seer=1", "Roles set: werewolf×2, seer×1, the rest villagers"},
+		{"werewolf doctor=0", "Roles set: werewolf×1, the rest villagers"},
+		{"seer=1", "at least one werewolf"},
+		{"werewolf=-1", "Bad role count"},
+		{"werewolf=14", "Bad role count"},
+		{"werewolf=9223372036854775807 seer=1", "Bad role count"},
+		{"werewolf=99999999999999999999", "Bad role count"},
+		{"villager=2", "Unknown role"},
+	}
+	for _, tt := range tests {
+		got := describe(setWerewolfRoles("G1", strings.Fields(tt.args)))
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("roles %s: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestStartWerewolf(t *testing.T) {
+	f := useFake(t)
+	game := openWerewolf(t, f, 4)
+
+	// Counts too large to add up are refused, not dealt.
+	game.roles = map[wwRole]int{roleWerewolf: int(^uint(0) >> 1), roleSeer: 1}
+	if got := describe(startWerewolf(inGroup)); !strings.Contains(got, "Not enough players") {
+		t.Errorf("huge roles: got %q", got)
+	}
+
+	game.roles = map[wwRole]int{roleWerewolf: 1, roleSeer: 1}
+	f.calls = nil
+	if got := describe(startWerewolf(inGroup)); !strings.Contains(got, "The game begins with 4 players") {
+		t.Fatalf("start: got %q", got)
+	}
+	dealt := map[wwRole]int{}
+	for _, p := range game.players {
+		dealt[p.role]++
+		if !strings.Contains(strings.Join(f.Calls(), "\n"), "push "+p.userID+": "+wwRoleInfo[p.role]) {
+			t.Errorf("%s was not told their role %s", p.userID, p.role)
+		}
+	}
+	if dealt[roleWerewolf] != 1 || dealt[roleSeer] != 1 || dealt[roleVillager] != 2 {
+		t.Errorf("dealt %v", dealt)
+	}
+	if !game.started || !game.night || game.phase != 1 {
+		t.Errorf("after start: started %v, night %v, phase %d", game.started, game.night, game.phase)
+	}
+}
+
+func TestWerewolfRound(t *testing.T) {
+	f := useFake(t)
+	game := openWerewolf(t, f, 4)
+	game.roles = map[wwRole]int{roleWerewolf: 1}
+	startWerewolf(inGroup)
+	var wolf *wwPlayer
+	var villagers []*wwPlayer
+	for _, p := range game.players {
+		if p.role == roleWerewolf {
+			wolf = p
+		} else {
+			villagers = append(villagers, p)
+		}
+	}
+	act := func(userID, op, target string, phase int) []string {
+		t.Helper()
+		f.calls = nil
+		data := url.Values{"a": {"ww"}, "op": {op}, "g": {"G1"}, "p": {fmt.Sprint(phase)}, "t": {target}}
+		src := &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: userID}
+		handleEvent(f, &linebot.Event{Type: linebot.EventTypePostback, ReplyToken: "T", Source: src, Postback: &linebot.Postback{Data: data.Encode()}})
+		return f.Calls()
+	}
+
+	// Villagers have nothing to do at night, and old buttons do nothing.
+	checkCalls(t, act(villagers[0].userID, "kill", villagers[1].userID, 1), []string{"reply T: You can't do that."})
+	checkCalls(t, act(wolf.userID, "kill", villagers[0].userID, 0), []string{"reply T: That choice is no longer open."})
+
+	// The only night role has acted, so morning comes at once.
+	checkCalls(t, act(wolf.userID, "kill", villagers[0].userID, 1), []string{
+		"push G1: ☀️ Morning comes. " + villagers[0].name + " was eaten by werewolves.",
+		"reply T: 🐺 You chose " + villagers[0].name + ".",
+	})
+	if villagers[0].alive || game.night || game.phase != 2 {
+		t.Fatalf("after the night: victim alive %v, night %v, phase %d", villagers[0].alive, game.night, game.phase)
+	}
+	checkCalls(t, act(villagers[0].userID, "vote", wolf.userID, 2), []string{"reply T: You can't do that."})
+
+	// Everyone alive votes for the wolf, who is hanged, and the village wins.
+	act(villagers[1].userID, "vote", wolf.userID, 2)
+	act(villagers[2].userID, "vote", wolf.userID, 2)
+	calls := act(wolf.userID, "vote", villagers[1].userID, 2)
+	checkCalls(t, calls, []string{"push G1: 🌆 The village hanged " + wolf.name + ", who was a werewolf.", "reply T: 🗳"})
+	if !strings.Contains(calls[0], "The village wins!") {
+		t.Errorf("got %q", calls[0])
+	}
+	werewolves.Lock()
+	defer werewolves.Unlock()
+	if werewolves.games["G1"] != nil {
+		t.Error("the game is still running")
+	}
+}